@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"wplug/pkg/config"
 
 	"github.com/urfave/cli/v3"
@@ -16,6 +18,32 @@ var configFlag = &cli.StringFlag{
 	Aliases: []string{"c", "cfg"},
 }
 
+var mockServerCommand = &cli.Command{
+	Name:  "mock-server",
+	Usage: "Run the ingestion stand-in (http, mqtt) described in the mock section of the config",
+	Flags: []cli.Flag{
+		configFlag,
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		filepath := command.String("config")
+
+		data, err := os.ReadFile(filepath)
+		if err != nil {
+			return err
+		}
+
+		conf, err := config.ParseConfig(data)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return conf.StartMockServer(ctx)
+	},
+}
+
 func main() {
 	log.SetPrefix("wplug: ")
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
@@ -26,6 +54,9 @@ func main() {
 		Flags: []cli.Flag{
 			configFlag,
 		},
+		Commands: []*cli.Command{
+			mockServerCommand,
+		},
 		Action: func(ctx context.Context, command *cli.Command) error {
 			filepath := command.String("config")
 
@@ -0,0 +1,579 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"wplug/pkg/coap"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/pion/dtls/v3"
+)
+
+// Config:
+// client:
+//	type: coap
+//	config:
+//		url: "coap://gateway:5683/ingest" # coaps:// enables dtls
+//		confirmable: true
+//		block-size: 1024 # 16 - 1024, larger payloads use block-wise transfer (always confirmable)
+//		timeout: 10s
+//		ack-timeout: 2s
+//		max-retransmit: 4
+//		consume-kafka: false
+//		encoding: cbor
+//		dtls:
+//			psk-identity: "sensor-1"
+//			psk-env: "COAP_PSK" # hex encoded key, or psk-file
+//			ca-file: "ca.pem" # certificate based instead of psk
+//---
+
+type CoAPConfig struct {
+	Url           *url.URL
+	Confirmable   bool
+	BlockSize     int
+	Timeout       time.Duration
+	AckTimeout    time.Duration
+	MaxRetransmit int
+	ConsumeKafka  bool
+	DTLS          DTLSConfig
+}
+
+type DTLSConfig struct {
+	TLS         TLSConfig
+	PSKIdentity string
+	PSK         []byte
+}
+
+type CoAPClient struct {
+	Config         CoAPConfig
+	ResponseWaiter *waiter.ResponseWaiter
+	encoder        Encoder
+	contentFormat  uint32
+
+	mu   sync.Mutex
+	conn net.Conn
+	// in-flight exchanges, by token and by message id for empty acks
+	byToken   map[string]*coapExchange
+	byMID     map[uint16]*coapExchange
+	messageID uint16
+}
+
+type coapExchange struct {
+	acked chan struct{}
+	resp  chan coap.Message
+	once  sync.Once
+}
+
+var errCoAPReset = errors.New("coap: message was reset by the server")
+
+func NewCoAPClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter) (*CoAPClient, error) {
+	var config CoAPConfig
+	var err error
+
+	rawUrl, err := stringValue(configMap, "url", "")
+	if err != nil {
+		return nil, err
+	}
+	if config.Url, err = url.Parse(rawUrl); err != nil || rawUrl == "" {
+		return nil, fmt.Errorf("config-map must include a valid url, is: %q", rawUrl)
+	}
+	if config.Url.Scheme != "coap" && config.Url.Scheme != "coaps" {
+		return nil, fmt.Errorf("url scheme must be coap or coaps, is: %s", config.Url.Scheme)
+	}
+
+	if config.Confirmable, err = boolValue(configMap, "confirmable", true); err != nil {
+		return nil, err
+	}
+	if config.BlockSize, err = intValue(configMap, "block-size", 1024); err != nil {
+		return nil, err
+	}
+	if _, err := coap.NewBlock(0, false, config.BlockSize); err != nil {
+		return nil, err
+	}
+	if config.Timeout, err = durationValue(configMap, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	// RFC 7252 defaults
+	if config.AckTimeout, err = durationValue(configMap, "ack-timeout", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if config.MaxRetransmit, err = intValue(configMap, "max-retransmit", 4); err != nil {
+		return nil, err
+	}
+	if config.ConsumeKafka, err = boolValue(configMap, "consume-kafka", true); err != nil {
+		return nil, err
+	}
+
+	dtlsMap, err := sectionValue(configMap, "dtls")
+	if err != nil {
+		return nil, err
+	}
+	if config.DTLS, err = parseDTLSConfig(dtlsMap); err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	contentFormat := coap.FormatOctetStream
+	switch encoder.(type) {
+	case JSONEncoder:
+		contentFormat = coap.FormatJSON
+	case CBOREncoder:
+		contentFormat = coap.FormatCBOR
+	}
+
+	return &CoAPClient{
+		Config:         config,
+		ResponseWaiter: rw,
+		encoder:        encoder,
+		contentFormat:  contentFormat,
+		byToken:        make(map[string]*coapExchange),
+		byMID:          make(map[uint16]*coapExchange),
+		messageID:      uint16(rand.Uint32()),
+	}, nil
+}
+
+func parseDTLSConfig(configMap map[string]interface{}) (DTLSConfig, error) {
+	var config DTLSConfig
+	var err error
+
+	if config.TLS, err = ParseTLSConfig(configMap); err != nil {
+		return config, err
+	}
+	if config.PSKIdentity, err = stringValue(configMap, "psk-identity", ""); err != nil {
+		return config, err
+	}
+
+	pskEnv, err := stringValue(configMap, "psk-env", "")
+	if err != nil {
+		return config, err
+	}
+	pskFile, err := stringValue(configMap, "psk-file", "")
+	if err != nil {
+		return config, err
+	}
+
+	var rawPSK string
+	switch {
+	case pskEnv != "":
+		rawPSK = os.Getenv(pskEnv)
+		if rawPSK == "" {
+			return config, fmt.Errorf("dtls: env var %s is empty", pskEnv)
+		}
+	case pskFile != "":
+		b, err := os.ReadFile(pskFile)
+		if err != nil {
+			return config, fmt.Errorf("dtls: reading psk-file failed with err: %v", err)
+		}
+		rawPSK = string(b)
+	}
+
+	if rawPSK != "" {
+		if config.PSK, err = hex.DecodeString(strings.TrimSpace(rawPSK)); err != nil {
+			return config, fmt.Errorf("dtls: psk must be hex encoded: %v", err)
+		}
+	}
+
+	return config, nil
+}
+
+func (c *CoAPClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	var waiterCh chan message.Confirmation
+	if c.Config.ConsumeKafka {
+		waiterCh = c.ResponseWaiter.RegisterMessage(req)
+		defer c.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+	}
+
+	b, err := c.encoder.Marshal(req)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: -1,
+			WireSize:    -1,
+		}
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.Config.Timeout)
+	defer cancel()
+
+	send := time.Now()
+	wireSize, err := c.post(callCtx, b)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    wireSize,
+		}
+	}
+
+	ack := time.Now()
+	// Not confirmed, or the message has nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    wireSize,
+			SendTime:    send,
+			AckTime:     ack,
+		}
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    wireSize,
+			SendTime:    send,
+			AckTime:     ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: len(b),
+		WireSize:    wireSize,
+		SendTime:    send,
+		AckTime:     ack,
+	}.WithConfirmation(conf)
+}
+
+func (c *CoAPClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// post sends payload as one request or block-wise, returns the bytes written including retransmissions.
+func (c *CoAPClient) post(ctx context.Context, payload []byte) (int, error) {
+	if len(payload) <= c.Config.BlockSize {
+		req := c.newRequest(payload)
+		if c.Config.Confirmable {
+			req.Type = coap.Confirmable
+		} else {
+			req.Type = coap.NonConfirmable
+		}
+
+		resp, written, err := c.exchange(ctx, req)
+		if err != nil {
+			return written, err
+		}
+		if req.Type == coap.Confirmable && !resp.Code.IsSuccess() {
+			return written, fmt.Errorf("recieved code: %s with payload: %s", resp.Code, resp.Payload)
+		}
+		return written, nil
+	}
+
+	// Block1: every block is confirmable, the server answers 2.31 Continue until the last block
+	total := 0
+	size := c.Config.BlockSize
+	for offset := 0; offset < len(payload); {
+		num := offset / size
+		end := min(offset+size, len(payload))
+		block, _ := coap.NewBlock(uint32(num), end < len(payload), size)
+
+		req := c.newRequest(payload[offset:end])
+		req.Type = coap.Confirmable
+		req.AddOption(coap.Block1, block.Encode())
+		if num == 0 {
+			req.AddUintOption(coap.Size1, uint32(len(payload)))
+		}
+
+		resp, written, err := c.exchange(ctx, req)
+		total += written
+		if err != nil {
+			return total, fmt.Errorf("block %d: %v", num, err)
+		}
+
+		if block.More && resp.Code != coap.Continue {
+			return total, fmt.Errorf("block %d: expected 2.31 continue, recieved: %s", num, resp.Code)
+		}
+		if !block.More && !resp.Code.IsSuccess() {
+			return total, fmt.Errorf("recieved code: %s with payload: %s", resp.Code, resp.Payload)
+		}
+
+		// The server may ask for smaller blocks in its first response, the following blocks use
+		// that size and their numbers count in it (RFC 7959 2.5)
+		if value, ok := resp.Option(coap.Block1); ok && offset == 0 {
+			ack, err := coap.DecodeBlock(value)
+			if err == nil && ack.Size < size {
+				size = ack.Size
+			}
+		}
+		offset = end
+	}
+
+	return total, nil
+}
+
+func (c *CoAPClient) newRequest(payload []byte) coap.Message {
+	token := make([]byte, 8)
+	for i := range token {
+		token[i] = byte(rand.Uint32())
+	}
+
+	req := coap.Message{
+		Code:    coap.POST,
+		Token:   token,
+		Payload: payload,
+	}
+	for _, segment := range strings.Split(strings.Trim(c.Config.Url.Path, "/"), "/") {
+		if segment != "" {
+			req.AddOption(coap.URIPath, []byte(segment))
+		}
+	}
+	for _, query := range strings.Split(c.Config.Url.RawQuery, "&") {
+		if query != "" {
+			req.AddOption(coap.URIQuery, []byte(query))
+		}
+	}
+	req.AddUintOption(coap.ContentFormat, c.contentFormat)
+
+	return req
+}
+
+// exchange sends req and waits for its response, confirmable messages are retransmitted
+// with exponential backoff until acked. Non-confirmable requests return after sending.
+func (c *CoAPClient) exchange(ctx context.Context, req coap.Message) (coap.Message, int, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return coap.Message{}, 0, err
+	}
+
+	ex := &coapExchange{
+		acked: make(chan struct{}),
+		resp:  make(chan coap.Message, 1),
+	}
+
+	c.mu.Lock()
+	c.messageID++
+	req.MessageID = c.messageID
+	c.byToken[string(req.Token)] = ex
+	c.byMID[req.MessageID] = ex
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.byToken, string(req.Token))
+		delete(c.byMID, req.MessageID)
+		c.mu.Unlock()
+	}()
+
+	datagram, err := req.Marshal()
+	if err != nil {
+		return coap.Message{}, 0, err
+	}
+
+	written := 0
+	if _, err := conn.Write(datagram); err != nil {
+		c.reset(conn)
+		return coap.Message{}, written, err
+	}
+	written += len(datagram)
+
+	if req.Type == coap.NonConfirmable {
+		return coap.Message{}, written, nil
+	}
+
+	// ACK_RANDOM_FACTOR = 1.5
+	timeout := c.Config.AckTimeout + time.Duration(rand.Float64()*float64(c.Config.AckTimeout)/2)
+	retransmits := 0
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case resp := <-ex.resp:
+			if resp.Type == coap.Reset {
+				return resp, written, errCoAPReset
+			}
+			return resp, written, nil
+		case <-ex.acked:
+			// Empty ack, the response follows separately
+			timer.Stop()
+			select {
+			case resp := <-ex.resp:
+				return resp, written, nil
+			case <-ctx.Done():
+				return coap.Message{}, written, fmt.Errorf("timeout waiting for separate response")
+			}
+		case <-timer.C:
+			if retransmits >= c.Config.MaxRetransmit {
+				return coap.Message{}, written, fmt.Errorf("no ack after %d retransmissions", retransmits)
+			}
+			if _, err := conn.Write(datagram); err != nil {
+				c.reset(conn)
+				return coap.Message{}, written, err
+			}
+			written += len(datagram)
+			retransmits++
+			timeout *= 2
+			timer.Reset(timeout)
+		case <-ctx.Done():
+			return coap.Message{}, written, fmt.Errorf("timeout waiting for ack")
+		}
+	}
+}
+
+// connection dials the udp or dtls connection on first use.
+func (c *CoAPClient) connection(ctx context.Context) (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	host := c.Config.Url.Host
+	if c.Config.Url.Port() == "" {
+		port := "5683"
+		if c.Config.Url.Scheme == "coaps" {
+			port = "5684"
+		}
+		host = net.JoinHostPort(c.Config.Url.Hostname(), port)
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if c.Config.Url.Scheme == "coaps" {
+		conn, err = c.dialDTLS(ctx, addr)
+	} else {
+		conn, err = net.DialUDP("udp", nil, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s failed with err: %v", host, err)
+	}
+
+	c.conn = conn
+	go c.read(conn)
+
+	return conn, nil
+}
+
+func (c *CoAPClient) dialDTLS(ctx context.Context, addr *net.UDPAddr) (net.Conn, error) {
+	config := &dtls.Config{
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+
+	tlsConfig, err := c.Config.DTLS.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		config.RootCAs = tlsConfig.RootCAs
+		config.Certificates = tlsConfig.Certificates
+		config.ServerName = tlsConfig.ServerName
+		config.InsecureSkipVerify = tlsConfig.InsecureSkipVerify
+	}
+	if config.ServerName == "" {
+		config.ServerName = c.Config.Url.Hostname()
+	}
+
+	if c.Config.DTLS.PSK != nil {
+		psk := c.Config.DTLS.PSK
+		config.PSK = func([]byte) ([]byte, error) { return psk, nil }
+		config.PSKIdentityHint = []byte(c.Config.DTLS.PSKIdentity)
+		config.CipherSuites = []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8, dtls.TLS_PSK_WITH_AES_128_GCM_SHA256}
+	}
+
+	conn, err := dtls.Dial("udp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// read dispatches incoming messages to their exchange until the connection is closed.
+func (c *CoAPClient) read(conn net.Conn) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			c.reset(conn)
+			return
+		}
+
+		msg, err := coap.Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		// Separate responses are confirmable and must be acked
+		if msg.Type == coap.Confirmable {
+			ack, _ := coap.Message{Type: coap.Acknowledgement, Code: coap.Empty, MessageID: msg.MessageID}.Marshal()
+			conn.Write(ack)
+		}
+
+		c.mu.Lock()
+		var ex *coapExchange
+		if msg.Code == coap.Empty || msg.Type == coap.Reset {
+			ex = c.byMID[msg.MessageID]
+		} else {
+			ex = c.byToken[string(msg.Token)]
+		}
+		c.mu.Unlock()
+
+		if ex == nil {
+			continue
+		}
+
+		if msg.Type == coap.Acknowledgement && msg.Code == coap.Empty {
+			ex.once.Do(func() { close(ex.acked) })
+			continue
+		}
+
+		select {
+		case ex.resp <- msg:
+		default:
+		}
+	}
+}
+
+func (c *CoAPClient) reset(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == conn {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"wplug/pkg/coap"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// coapStandIn reassembles Block1 uploads and drops the first datagram it sees to force a retransmission
+type coapStandIn struct {
+	conn     *net.UDPConn
+	received chan []byte
+	dropped  atomic.Bool
+	// maxBlock asks for smaller blocks in the first response, 0 accepts any size
+	maxBlock int
+	// sizes of the blocks of the last upload, read after it was received
+	sizes []int
+}
+
+func startCoAPStandIn(t *testing.T, maxBlock int) *coapStandIn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &coapStandIn{conn: conn, received: make(chan []byte, 16), maxBlock: maxBlock}
+	go s.serve()
+	return s
+}
+
+func (s *coapStandIn) serve() {
+	buf := make([]byte, 64*1024)
+	var body []byte
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if s.dropped.CompareAndSwap(false, true) {
+			continue
+		}
+
+		req, err := coap.Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		resp := coap.Message{Type: coap.Acknowledgement, MessageID: req.MessageID, Token: req.Token, Code: coap.Changed}
+		if req.Type == coap.NonConfirmable {
+			resp.Type = coap.NonConfirmable
+		}
+
+		more := false
+		if value, ok := req.Option(coap.Block1); ok {
+			block, _ := coap.DecodeBlock(value)
+			if block.Num == 0 {
+				body, s.sizes = nil, nil
+			}
+			// The block number counts in the size of the block
+			if int(block.Num)*block.Size != len(body) {
+				resp.Code = coap.BadRequest
+				data, _ := resp.Marshal()
+				s.conn.WriteToUDP(data, addr)
+				continue
+			}
+			s.sizes = append(s.sizes, block.Size)
+			more = block.More
+			if block.Num == 0 && s.maxBlock > 0 && block.Size > s.maxBlock {
+				smaller, _ := coap.NewBlock(0, more, s.maxBlock)
+				value = smaller.Encode()
+			}
+			resp.AddOption(coap.Block1, value)
+			if more {
+				resp.Code = coap.Continue
+			}
+		} else {
+			body = nil
+		}
+
+		body = append(body, req.Payload...)
+		if !more {
+			s.received <- body
+		}
+
+		data, _ := resp.Marshal()
+		s.conn.WriteToUDP(data, addr)
+	}
+}
+
+func TestCoAPClient_BlockWise(t *testing.T) {
+	standIn := startCoAPStandIn(t, 0)
+
+	cl, err := NewCoAPClient(map[string]interface{}{
+		"url":           "coap://" + standIn.conn.LocalAddr().String() + "/import/ingest",
+		"block-size":    uint64(64),
+		"ack-timeout":   "20ms",
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	msg := message.NewProvider(1, 1000).GetData()
+	resp := cl.CallEndpoint(context.Background(), msg)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.WireSize <= resp.MessageSize {
+		t.Fatalf("expected wire-size %d to include headers and the retransmission, message-size: %d", resp.WireSize, resp.MessageSize)
+	}
+
+	var got message.Message
+	if err := jsoniter.Unmarshal(<-standIn.received, &got); err != nil {
+		t.Fatalf("reassembled payload is invalid: %v", err)
+	}
+	if got.DeviceInfo.DeviceID != msg.DeviceInfo.DeviceID {
+		t.Fatalf("expected device id %s, got: %s", msg.DeviceInfo.DeviceID, got.DeviceInfo.DeviceID)
+	}
+}
+
+func TestCoAPClient_NonConfirmable(t *testing.T) {
+	standIn := startCoAPStandIn(t, 0)
+	standIn.dropped.Store(true)
+
+	cl, err := NewCoAPClient(map[string]interface{}{
+		"url":           "coap://" + standIn.conn.LocalAddr().String() + "/ingest",
+		"confirmable":   false,
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 100).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	<-standIn.received
+}
+
+func TestCoAPClient_BlockWiseSmallerSize(t *testing.T) {
+	standIn := startCoAPStandIn(t, 32)
+	standIn.dropped.Store(true)
+
+	cl, err := NewCoAPClient(map[string]interface{}{
+		"url":           "coap://" + standIn.conn.LocalAddr().String() + "/ingest",
+		"block-size":    uint64(128),
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	msg := message.NewProvider(1, 1000).GetData()
+	resp := cl.CallEndpoint(context.Background(), msg)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+
+	var got message.Message
+	if err := jsoniter.Unmarshal(<-standIn.received, &got); err != nil {
+		t.Fatalf("reassembled payload is invalid: %v", err)
+	}
+	if got.DeviceInfo.DeviceID != msg.DeviceInfo.DeviceID {
+		t.Fatalf("expected device id %s, got: %s", msg.DeviceInfo.DeviceID, got.DeviceInfo.DeviceID)
+	}
+	// The first block keeps its size, the following ones use the requested one
+	if len(standIn.sizes) < 3 || standIn.sizes[0] != 128 || standIn.sizes[1] != 32 {
+		t.Fatalf("unexpected block sizes: %v", standIn.sizes)
+	}
+}
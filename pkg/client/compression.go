@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Config:
+// compression:
+//	algorithm: gzip # none, gzip, deflate, zstd
+//	level: 6 # optional, algorithm specific
+//---
+
+const (
+	CompressionNone    = "none"
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+	CompressionZstd    = "zstd"
+)
+
+type CompressionConfig struct {
+	Algorithm string
+	Level     int
+}
+
+// Compressor is safe for concurrent use.
+type Compressor struct {
+	Config CompressionConfig
+	zstd   *zstd.Encoder
+}
+
+func ParseCompressionConfig(configMap map[string]interface{}) (CompressionConfig, error) {
+	var config CompressionConfig
+
+	algorithm, err := stringValue(configMap, "algorithm", CompressionNone)
+	if err != nil {
+		return config, err
+	}
+	config.Algorithm = strings.ToLower(algorithm)
+
+	var defaultLevel int
+	switch config.Algorithm {
+	case CompressionNone:
+	case CompressionGzip, CompressionDeflate:
+		defaultLevel = flate.DefaultCompression
+	case CompressionZstd:
+		defaultLevel = 3 // zstd's own default
+	default:
+		return config, fmt.Errorf("compression must be one of none, gzip, deflate, zstd, is: %s", algorithm)
+	}
+
+	if config.Level, err = intValue(configMap, "level", defaultLevel); err != nil {
+		return config, err
+	}
+
+	if (config.Algorithm == CompressionGzip || config.Algorithm == CompressionDeflate) &&
+		(config.Level < flate.HuffmanOnly || config.Level > flate.BestCompression) {
+		return config, fmt.Errorf("%s level must be between %d and %d, is: %d", config.Algorithm, flate.HuffmanOnly, flate.BestCompression, config.Level)
+	}
+
+	return config, nil
+}
+
+func NewCompressor(config CompressionConfig) (*Compressor, error) {
+	c := &Compressor{Config: config}
+
+	if config.Algorithm == CompressionZstd {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(config.Level)))
+		if err != nil {
+			return nil, fmt.Errorf("creating zstd encoder failed with err: %v", err)
+		}
+		c.zstd = enc
+	}
+
+	return c, nil
+}
+
+// ContentEncoding returns the value for the HTTP Content-Encoding header, "" if uncompressed.
+func (c *Compressor) ContentEncoding() string {
+	if c == nil || c.Config.Algorithm == CompressionNone {
+		return ""
+	}
+	return c.Config.Algorithm
+}
+
+func (c *Compressor) Compress(b []byte) ([]byte, error) {
+	if c == nil {
+		return b, nil
+	}
+
+	switch c.Config.Algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, c.Config.Level)
+		if err != nil {
+			return nil, err
+		}
+		return closeCompressor(&buf, w, b)
+	case CompressionDeflate:
+		// Content-Encoding: deflate is the zlib format (RFC 1950)
+		var buf bytes.Buffer
+		w, err := zlib.NewWriterLevel(&buf, c.Config.Level)
+		if err != nil {
+			return nil, err
+		}
+		return closeCompressor(&buf, w, b)
+	case CompressionZstd:
+		return c.zstd.EncodeAll(b, make([]byte, 0, len(b)/2)), nil
+	default:
+		return b, nil
+	}
+}
+
+func closeCompressor(buf *bytes.Buffer, w io.WriteCloser, b []byte) ([]byte, error) {
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// zstdDecoder is shared, DecodeAll is safe for concurrent use
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil)
+})
+
+// Decompress reverses Compress for the given Content-Encoding, "" and none return b as is.
+func Decompress(b []byte, algorithm string) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+
+	switch strings.ToLower(algorithm) {
+	case "", CompressionNone, "identity":
+		return b, nil
+	case CompressionGzip:
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case CompressionDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(b))
+	case CompressionZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(b, nil)
+	default:
+		return nil, fmt.Errorf("compression must be one of none, gzip, deflate, zstd, is: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The client configs arrive as the raw `client.config` yaml section. These helpers
+// read optional keys from it and fall back to a default if the key is missing.
+
+func stringValue(configMap map[string]interface{}, key string, def string) (string, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got: %T", key, val)
+	}
+	return s, nil
+}
+
+func boolValue(configMap map[string]interface{}, key string, def bool) (bool, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	b, ok := val.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be a bool, got: %T", key, val)
+	}
+	return b, nil
+}
+
+// yaml decodes positive numbers as uint64 and negative ones as int64,
+// values passed from code are usually plain ints.
+func intValue(configMap map[string]interface{}, key string, def int) (int, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := val.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case uint64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("%s must be a number, got: %T", key, val)
+	}
+}
+
+func floatValue(configMap map[string]interface{}, key string, def float64) (float64, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	default:
+		return 0, fmt.Errorf("%s must be a number, got: %T", key, val)
+	}
+}
+
+// durationValue accepts duration strings such as "300ms" or "2h45m" and time.Duration values.
+func durationValue(configMap map[string]interface{}, key string, def time.Duration) (time.Duration, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := val.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("parsing %s failed with err: %v", key, err)
+		}
+		return dur, nil
+	default:
+		return 0, fmt.Errorf("%s must be a duration, got: %T", key, val)
+	}
+}
+
+func stringSliceValue(configMap map[string]interface{}, key string, def []string) ([]string, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := val.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings, got item: %T", key, item)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings, got: %T", key, val)
+	}
+}
+
+func intSliceValue(configMap map[string]interface{}, key string, def []int) ([]int, error) {
+	val, ok := configMap[key]
+	if !ok {
+		return def, nil
+	}
+
+	items, ok := val.([]interface{})
+	if !ok {
+		if ints, ok := val.([]int); ok {
+			return ints, nil
+		}
+		return nil, fmt.Errorf("%s must be a list of numbers, got: %T", key, val)
+	}
+
+	out := make([]int, 0, len(items))
+	for _, item := range items {
+		i, err := intValue(map[string]interface{}{key: item}, key, 0)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// sectionValue returns a nested section, e.g. `tls:` inside the client config.
+func sectionValue(configMap map[string]interface{}, key string) (map[string]interface{}, error) {
+	val, ok := configMap[key]
+	if !ok || val == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	section, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a section, got: %T", key, val)
+	}
+	return section, nil
+}
+
+// confirmValue reads confirm, whether a client waits for the confirmation of the configured
+// consumer. consume-kafka is the older name of it.
+func confirmValue(configMap map[string]interface{}, def bool) (bool, error) {
+	if _, ok := configMap["confirm"]; ok {
+		return boolValue(configMap, "confirm", def)
+	}
+	return boolValue(configMap, "consume-kafka", def)
+}
+
+// sectionListValue returns a list of sections, e.g. the `operations:` of the http client.
+func sectionListValue(configMap map[string]interface{}, key string) ([]map[string]interface{}, error) {
+	val, ok := configMap[key]
+	if !ok || val == nil {
+		return nil, nil
+	}
+
+	switch v := val.(type) {
+	case []map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			section, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of sections, got item: %T", key, item)
+			}
+			out = append(out, section)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of sections, got: %T", key, val)
+	}
+}
+
+// headerValue reads a section of header names to values.
+func headerValue(configMap map[string]interface{}, key string) (http.Header, error) {
+	headerMap, err := sectionValue(configMap, key)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header{}
+	for name := range headerMap {
+		val, err := stringValue(headerMap, name, "")
+		if err != nil {
+			return nil, err
+		}
+		headers.Set(name, val)
+	}
+	return headers, nil
+}
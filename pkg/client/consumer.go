@@ -0,0 +1,9 @@
+package client
+
+import "context"
+
+// Consumer reads confirmations of processed messages and delivers them to the ResponseWaiter.
+// Start must not block.
+type Consumer interface {
+	Start(ctx context.Context)
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"strings"
+	"wplug/pkg/message"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Every message carries its own id (messageId in the payload), the clients also put it on the
+// transport where there is a place for it: an http header, a kafka/nats header, the amqp
+// message-id and grpc metadata. MQTT 3.1.1 has no user properties, there it's the payload only.
+//
+// Config:
+// kafka: # or nats
+//	correlation:
+//		header: "correlation-id" # take the key from this header
+//		json-path: "meta.messageId" # or from this field of the confirmed message
+//---
+
+const (
+	DefaultCorrelationHeader = "X-Correlation-ID"
+	// CorrelationHeader is used on the transports without a configurable header
+	CorrelationHeader = "correlation-id"
+)
+
+// CorrelationConfig tells a consumer where to find the key of a confirmed message. The header wins
+// over the json path, if neither yields a value the key is message.CorrelationID().
+type CorrelationConfig struct {
+	Header   string `yaml:"header"`
+	JSONPath string `yaml:"json-path"`
+}
+
+// Key returns the waiter key of a consumed message, header looks up a transport header by name.
+func (c CorrelationConfig) Key(value []byte, header func(string) string, msg message.Message) string {
+	if c.Header != "" && header != nil {
+		if key := header(c.Header); key != "" {
+			return key
+		}
+	}
+	if c.JSONPath != "" {
+		if key := JSONPathValue(value, c.JSONPath); key != "" {
+			return key
+		}
+	}
+	return msg.CorrelationID()
+}
+
+// JSONPathValue reads a dot separated path such as "data.accessToken" from a json body.
+func JSONPathValue(body []byte, path string) string {
+	keys := strings.Split(path, ".")
+	p := make([]interface{}, len(keys))
+	for i, key := range keys {
+		p[i] = key
+	}
+	return jsoniter.Get(body, p...).ToString()
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"wplug/pkg/message"
+	"wplug/pkg/message/pb"
+
+	"github.com/fxamacker/cbor/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Decoder is the counterpart of Encoder, used by the mock server and consumers.
+type Decoder interface {
+	Unmarshal(b []byte) (message.Message, error)
+}
+
+// NewDecoder accepts the same names as NewEncoder.
+func NewDecoder(name string) (Decoder, error) {
+	switch strings.ToLower(name) {
+	case EncodingJSON:
+		return JSONDecoder{api: jsoniter.ConfigFastest}, nil
+	case EncodingProtobuf:
+		return ProtobufDecoder{}, nil
+	case EncodingCBOR:
+		return CBORDecoder{}, nil
+	case EncodingMsgPack:
+		return MsgPackDecoder{}, nil
+	default:
+		return nil, fmt.Errorf("encoding must be one of json, protobuf, cbor, msgpack, is: %s", name)
+	}
+}
+
+// DecoderForContentType maps the content types of the encoders back to their decoder,
+// an empty content type is treated as json.
+func DecoderForContentType(contentType string) (Decoder, error) {
+	if contentType == "" {
+		return NewDecoder(EncodingJSON)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing content type failed with err: %v", err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		return NewDecoder(EncodingJSON)
+	case "application/x-protobuf", "application/protobuf":
+		return NewDecoder(EncodingProtobuf)
+	case "application/cbor":
+		return NewDecoder(EncodingCBOR)
+	case "application/msgpack", "application/x-msgpack":
+		return NewDecoder(EncodingMsgPack)
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+}
+
+type JSONDecoder struct {
+	api jsoniter.API
+}
+
+// NewStrictJSONDecoder rejects fields that are not part of message.Message.
+func NewStrictJSONDecoder() JSONDecoder {
+	return JSONDecoder{api: jsoniter.Config{DisallowUnknownFields: true}.Froze()}
+}
+
+func (d JSONDecoder) Unmarshal(b []byte) (message.Message, error) {
+	var msg message.Message
+	err := d.api.Unmarshal(b, &msg)
+	return msg, err
+}
+
+type ProtobufDecoder struct{}
+
+func (d ProtobufDecoder) Unmarshal(b []byte) (message.Message, error) {
+	var p pb.Message
+	if err := proto.Unmarshal(b, &p); err != nil {
+		return message.Message{}, err
+	}
+	return message.FromProto(&p), nil
+}
+
+type CBORDecoder struct{}
+
+func (d CBORDecoder) Unmarshal(b []byte) (message.Message, error) {
+	var msg message.Message
+	err := cbor.Unmarshal(b, &msg)
+	return msg, err
+}
+
+type MsgPackDecoder struct{}
+
+func (d MsgPackDecoder) Unmarshal(b []byte) (message.Message, error) {
+	var msg message.Message
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	err := dec.Decode(&msg)
+	return msg, err
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Config:
+// delay:
+//	distribution: exponential # constant, uniform, normal, exponential, lognormal
+//	mean: 20ms # constant, normal, exponential, lognormal
+//	stddev: 5ms # normal, lognormal
+//	min: 0s # uniform lower bound, lower clamp for the others
+//	max: 1s # uniform upper bound, upper clamp for the others (0 = none)
+//---
+
+const (
+	DistributionConstant    = "constant"
+	DistributionUniform     = "uniform"
+	DistributionNormal      = "normal"
+	DistributionExponential = "exponential"
+	DistributionLogNormal   = "lognormal"
+)
+
+// DelayDistribution draws synthetic latencies, it is safe for concurrent use.
+type DelayDistribution struct {
+	Distribution string
+	Mean         time.Duration
+	StdDev       time.Duration
+	Min          time.Duration
+	Max          time.Duration
+}
+
+func ParseDelayDistribution(configMap map[string]interface{}) (DelayDistribution, error) {
+	var d DelayDistribution
+	var err error
+
+	distribution, err := stringValue(configMap, "distribution", DistributionConstant)
+	if err != nil {
+		return d, err
+	}
+	d.Distribution = strings.ToLower(distribution)
+
+	if d.Mean, err = durationValue(configMap, "mean", 0); err != nil {
+		return d, err
+	}
+	if d.StdDev, err = durationValue(configMap, "stddev", 0); err != nil {
+		return d, err
+	}
+	if d.Min, err = durationValue(configMap, "min", 0); err != nil {
+		return d, err
+	}
+	if d.Max, err = durationValue(configMap, "max", 0); err != nil {
+		return d, err
+	}
+
+	switch d.Distribution {
+	case DistributionConstant, DistributionNormal, DistributionExponential:
+	case DistributionUniform:
+		if d.Max < d.Min {
+			return d, fmt.Errorf("uniform delay needs max >= min, is: min %v max %v", d.Min, d.Max)
+		}
+	case DistributionLogNormal:
+		if d.Mean <= 0 {
+			return d, fmt.Errorf("lognormal delay needs a positive mean")
+		}
+	default:
+		return d, fmt.Errorf("distribution must be one of constant, uniform, normal, exponential, lognormal, is: %s", distribution)
+	}
+
+	return d, nil
+}
+
+func (d DelayDistribution) Sample() time.Duration {
+	var v float64
+	switch d.Distribution {
+	case DistributionUniform:
+		return d.Min + time.Duration(rand.Int64N(int64(d.Max-d.Min)+1))
+	case DistributionNormal:
+		v = float64(d.Mean) + rand.NormFloat64()*float64(d.StdDev)
+	case DistributionExponential:
+		v = rand.ExpFloat64() * float64(d.Mean)
+	case DistributionLogNormal:
+		// mu and sigma of the underlying normal distribution, so the samples have Mean and StdDev
+		mean, stddev := float64(d.Mean), float64(d.StdDev)
+		sigma2 := math.Log(1 + stddev*stddev/(mean*mean))
+		mu := math.Log(mean) - sigma2/2
+		v = math.Exp(mu + rand.NormFloat64()*math.Sqrt(sigma2))
+	default:
+		v = float64(d.Mean)
+	}
+
+	delay := time.Duration(v)
+	if delay < d.Min {
+		delay = d.Min
+	}
+	if d.Max > 0 && delay > d.Max {
+		delay = d.Max
+	}
+	return delay
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"wplug/pkg/message"
+
+	"github.com/fxamacker/cbor/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Config:
+// client:
+//	config:
+//		encoding: json # json, protobuf, cbor, msgpack
+//---
+
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+	EncodingCBOR     = "cbor"
+	EncodingMsgPack  = "msgpack"
+)
+
+// Encoder serialises a message.Message for the wire. Implementations must be safe for concurrent use.
+type Encoder interface {
+	Marshal(msg message.Message) ([]byte, error)
+	ContentType() string
+}
+
+func NewEncoder(name string) (Encoder, error) {
+	switch strings.ToLower(name) {
+	case EncodingJSON:
+		return JSONEncoder{api: jsoniter.ConfigFastest}, nil
+	case EncodingProtobuf:
+		return ProtobufEncoder{}, nil
+	case EncodingCBOR:
+		// CBOR falls back to the json tags of message.Message
+		mode, err := cbor.EncOptions{}.EncMode()
+		if err != nil {
+			return nil, err
+		}
+		return CBOREncoder{mode: mode}, nil
+	case EncodingMsgPack:
+		return MsgPackEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("encoding must be one of json, protobuf, cbor, msgpack, is: %s", name)
+	}
+}
+
+func encoderFromConfig(configMap map[string]interface{}) (Encoder, error) {
+	name, err := stringValue(configMap, "encoding", EncodingJSON)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncoder(name)
+}
+
+type JSONEncoder struct {
+	api jsoniter.API
+}
+
+func (e JSONEncoder) Marshal(msg message.Message) ([]byte, error) {
+	return e.api.Marshal(msg)
+}
+
+func (e JSONEncoder) ContentType() string {
+	return "application/json"
+}
+
+// ProtobufEncoder uses the schema shipped in pkg/message/pb/message.proto.
+type ProtobufEncoder struct{}
+
+func (e ProtobufEncoder) Marshal(msg message.Message) ([]byte, error) {
+	return proto.Marshal(msg.ToProto())
+}
+
+func (e ProtobufEncoder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+type CBOREncoder struct {
+	mode cbor.EncMode
+}
+
+func (e CBOREncoder) Marshal(msg message.Message) ([]byte, error) {
+	return e.mode.Marshal(msg)
+}
+
+func (e CBOREncoder) ContentType() string {
+	return "application/cbor"
+}
+
+type MsgPackEncoder struct{}
+
+func (e MsgPackEncoder) Marshal(msg message.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// Use the same field names as the json payload
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (e MsgPackEncoder) ContentType() string {
+	return "application/msgpack"
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"testing"
+	"wplug/pkg/message"
+	"wplug/pkg/message/pb"
+
+	"github.com/fxamacker/cbor/v2"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncoders_RoundTrip(t *testing.T) {
+	msg := message.NewProvider(1, 1000).GetData()
+
+	decoders := map[string]func([]byte) (string, int, error){
+		EncodingJSON: func(b []byte) (string, int, error) {
+			var out message.Message
+			err := jsoniter.Unmarshal(b, &out)
+			return out.DeviceInfo.DeviceID, len(out.Measurements.Cumulative), err
+		},
+		EncodingProtobuf: func(b []byte) (string, int, error) {
+			var out pb.Message
+			err := proto.Unmarshal(b, &out)
+			return out.GetDeviceInfo().GetDeviceId(), len(out.GetMeasurements().GetCumulative()), err
+		},
+		EncodingCBOR: func(b []byte) (string, int, error) {
+			var out message.Message
+			err := cbor.Unmarshal(b, &out)
+			return out.DeviceInfo.DeviceID, len(out.Measurements.Cumulative), err
+		},
+		EncodingMsgPack: func(b []byte) (string, int, error) {
+			var out map[string]interface{}
+			if err := msgpack.Unmarshal(b, &out); err != nil {
+				return "", 0, err
+			}
+			// Keys must match the json payload
+			deviceInfo := out["deviceInfo"].(map[string]interface{})
+			measurements := out["measurements"].(map[string]interface{})
+			return deviceInfo["deviceId"].(string), len(measurements["cumulative"].([]interface{})), nil
+		},
+	}
+
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			enc, err := NewEncoder(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := enc.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deviceID, cumulatives, err := decode(b)
+			if err != nil {
+				t.Fatalf("decoding %s failed with err: %v", enc.ContentType(), err)
+			}
+			if deviceID != msg.DeviceInfo.DeviceID {
+				t.Fatalf("expected device id %s, got: %s", msg.DeviceInfo.DeviceID, deviceID)
+			}
+			if cumulatives != len(msg.Measurements.Cumulative) {
+				t.Fatalf("expected %d cumulatives, got: %d", len(msg.Measurements.Cumulative), cumulatives)
+			}
+		})
+	}
+}
+
+func TestDecoders_RoundTrip(t *testing.T) {
+	msg := message.NewProvider(1, 1000).GetData()
+
+	for _, name := range []string{EncodingJSON, EncodingProtobuf, EncodingCBOR, EncodingMsgPack} {
+		t.Run(name, func(t *testing.T) {
+			enc, err := NewEncoder(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := enc.Marshal(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dec, err := DecoderForContentType(enc.ContentType())
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := dec.Unmarshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.DeviceInfo.DeviceID != msg.DeviceInfo.DeviceID || len(out.Measurements.Cumulative) != len(msg.Measurements.Cumulative) {
+				t.Fatalf("round trip lost data: %+v", out.DeviceInfo)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/message/pb"
+	"wplug/pkg/waiter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Config:
+// client:
+//	type: grpc
+//	config:
+//		target: "localhost:50051"
+//		mode: unary # unary, stream (client-streaming)
+//		chunk-size: 10 # stream: cumulative samples per streamed message
+//		timeout: 10s
+//		consume-kafka: false
+//		metadata:
+//			authorization: "Bearer token"
+//		tls:
+//			ca-file: "ca.pem"
+//---
+
+const (
+	GRPCModeUnary  = "unary"
+	GRPCModeStream = "stream"
+)
+
+type GRPCConfig struct {
+	Target       string
+	Mode         string
+	ChunkSize    int
+	Timeout      time.Duration
+	ConsumeKafka bool
+	Metadata     map[string]string
+	TLS          TLSConfig
+}
+
+type GRPCClient struct {
+	Config         GRPCConfig
+	Conn           *grpc.ClientConn
+	Ingest         pb.IngestServiceClient
+	ResponseWaiter *waiter.ResponseWaiter
+}
+
+// NewGRPCClient creates the connection lazily, dialOpts are appended to the ones derived from the config.
+func NewGRPCClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter, dialOpts ...grpc.DialOption) (*GRPCClient, error) {
+	var config GRPCConfig
+	var err error
+
+	if config.Target, err = stringValue(configMap, "target", ""); err != nil {
+		return nil, err
+	}
+	if config.Target == "" {
+		return nil, fmt.Errorf("config-map must include target")
+	}
+
+	mode, err := stringValue(configMap, "mode", GRPCModeUnary)
+	if err != nil {
+		return nil, err
+	}
+	config.Mode = strings.ToLower(mode)
+	if config.Mode != GRPCModeUnary && config.Mode != GRPCModeStream {
+		return nil, fmt.Errorf("mode must be one of unary, stream, is: %s", mode)
+	}
+
+	if config.ChunkSize, err = intValue(configMap, "chunk-size", 10); err != nil {
+		return nil, err
+	}
+	if config.ChunkSize < 1 {
+		return nil, fmt.Errorf("chunk-size must be at least 1, is: %d", config.ChunkSize)
+	}
+	if config.Timeout, err = durationValue(configMap, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.ConsumeKafka, err = boolValue(configMap, "consume-kafka", true); err != nil {
+		return nil, err
+	}
+
+	mdMap, err := sectionValue(configMap, "metadata")
+	if err != nil {
+		return nil, err
+	}
+	config.Metadata = make(map[string]string, len(mdMap))
+	for key := range mdMap {
+		if config.Metadata[key], err = stringValue(mdMap, key, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsMap, err := sectionValue(configMap, "tls")
+	if err != nil {
+		return nil, err
+	}
+	if config.TLS, err = ParseTLSConfig(tlsMap); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, dialOpts...)
+	conn, err := grpc.NewClient(config.Target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating grpc client failed with err: %v", err)
+	}
+
+	return &GRPCClient{
+		Config:         config,
+		Conn:           conn,
+		Ingest:         pb.NewIngestServiceClient(conn),
+		ResponseWaiter: rw,
+	}, nil
+}
+
+func (c GRPCClient) Close() error {
+	return c.Conn.Close()
+}
+
+func (c GRPCClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	var waiterCh chan message.Confirmation
+	if c.Config.ConsumeKafka {
+		waiterCh = c.ResponseWaiter.RegisterMessage(req)
+		defer c.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.Config.Timeout)
+	defer cancel()
+	if len(c.Config.Metadata) > 0 {
+		callCtx = metadata.NewOutgoingContext(callCtx, metadata.New(c.Config.Metadata))
+	}
+	callCtx = metadata.AppendToOutgoingContext(callCtx, CorrelationHeader, req.CorrelationID())
+
+	var size int
+	var err error
+
+	send := time.Now()
+	switch c.Config.Mode {
+	case GRPCModeStream:
+		size, err = c.stream(callCtx, req)
+	default:
+		msg := req.ToProto()
+		size = proto.Size(msg)
+		_, err = c.Ingest.Ingest(callCtx, msg)
+	}
+
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: size,
+			WireSize:    size,
+		}
+	}
+
+	ack := time.Now()
+	// Not confirmed, or the message has nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(start),
+			MessageSize: size,
+			WireSize:    size,
+			SendTime:    send,
+			AckTime:     ack,
+		}
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: size,
+			WireSize:    size,
+			SendTime:    send,
+			AckTime:     ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: size,
+		WireSize:    size,
+		SendTime:    send,
+		AckTime:     ack,
+	}.WithConfirmation(conf)
+}
+
+// stream sends the batch in chunks of ChunkSize cumulative samples and waits for the single response.
+func (c GRPCClient) stream(ctx context.Context, req message.Message) (int, error) {
+	stream, err := c.Ingest.IngestStream(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	size := 0
+	for _, chunk := range req.Chunks(c.Config.ChunkSize) {
+		msg := chunk.ToProto()
+		size += proto.Size(msg)
+		if err := stream.Send(msg); err != nil {
+			return size, err
+		}
+	}
+
+	_, err = stream.CloseAndRecv()
+	return size, err
+}
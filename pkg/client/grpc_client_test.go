@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"wplug/pkg/message"
+	"wplug/pkg/message/pb"
+	"wplug/pkg/waiter"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// ingestStandIn is an in-process IngestService that records what it received
+type ingestStandIn struct {
+	pb.UnimplementedIngestServiceServer
+	received chan *pb.Message
+	tokens   chan string
+}
+
+func (s *ingestStandIn) Ingest(ctx context.Context, msg *pb.Message) (*pb.IngestResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.tokens <- first(md.Get("authorization"))
+	s.received <- msg
+	return &pb.IngestResponse{Accepted: 1}, nil
+}
+
+func (s *ingestStandIn) IngestStream(stream grpc.ClientStreamingServer[pb.Message, pb.IngestResponse]) error {
+	var accepted int64
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.IngestResponse{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		accepted++
+		s.received <- msg
+	}
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func startStandIn(t *testing.T) (*ingestStandIn, grpc.DialOption) {
+	lis := bufconn.Listen(1 << 20)
+	standIn := &ingestStandIn{
+		received: make(chan *pb.Message, 128),
+		tokens:   make(chan string, 128),
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterIngestServiceServer(srv, standIn)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+	return standIn, dialer
+}
+
+func TestGRPCClient_Unary(t *testing.T) {
+	standIn, dialer := startStandIn(t)
+
+	cl, err := NewGRPCClient(map[string]interface{}{
+		"target":        "passthrough:///bufnet",
+		"consume-kafka": false,
+		"metadata": map[string]interface{}{
+			"authorization": "Bearer test",
+		},
+	}, waiter.NewResponseWaiter(), dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	msg := message.NewProvider(1, 1000).GetData()
+	resp := cl.CallEndpoint(context.Background(), msg)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+
+	if token := <-standIn.tokens; token != "Bearer test" {
+		t.Fatalf("expected authorization metadata, got: %q", token)
+	}
+	got := <-standIn.received
+	if got.GetDeviceInfo().GetDeviceId() != msg.DeviceInfo.DeviceID {
+		t.Fatalf("expected device id %s, got: %s", msg.DeviceInfo.DeviceID, got.GetDeviceInfo().GetDeviceId())
+	}
+}
+
+func TestGRPCClient_Stream(t *testing.T) {
+	standIn, dialer := startStandIn(t)
+
+	cl, err := NewGRPCClient(map[string]interface{}{
+		"target":        "passthrough:///bufnet",
+		"mode":          "stream",
+		"chunk-size":    uint64(2),
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter(), dialer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	msg := message.NewProvider(1, 1000).GetData()
+	resp := cl.CallEndpoint(context.Background(), msg)
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+
+	expected := (len(msg.Measurements.Cumulative) + 1) / 2
+	samples := 0
+	for range expected {
+		samples += len((<-standIn.received).GetMeasurements().GetCumulative())
+	}
+	if samples != len(msg.Measurements.Cumulative) {
+		t.Fatalf("expected %d samples over the stream, got: %d", len(msg.Measurements.Cumulative), samples)
+	}
+}
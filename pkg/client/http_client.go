@@ -3,10 +3,10 @@ package client
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"time"
 	"wplug/pkg/message"
 	"wplug/pkg/waiter"
@@ -19,6 +19,13 @@ type HTTPConfig struct {
 	Timeout      time.Duration
 	ContentType  string
 	ConsumeKafka bool
+	Transport    HTTPTransportConfig
+	Compression  CompressionConfig
+	Retry        RetryConfig
+	Mode         string
+	Operations   []HTTPOperation
+	// CorrelationHeader carries the message id on every request, empty disables it
+	CorrelationHeader string
 }
 
 type HTTPClient struct {
@@ -26,6 +33,9 @@ type HTTPClient struct {
 	Client         *http.Client
 	ResponseWaiter *waiter.ResponseWaiter
 	JsonFast       jsoniter.API
+	Encoder        Encoder
+	Compressor     *Compressor
+	operations     operationPicker
 }
 
 func NewHTTPClientFromParams(host string, port int, timeout time.Duration, contentType string, consumeKafka bool, rw *waiter.ResponseWaiter) (*HTTPClient, error) {
@@ -50,31 +60,70 @@ func NewHTTPClientFromConfig(configMap map[string]interface{}, rw *waiter.Respon
 
 	if host, ok := configMap["url"]; ok {
 		config.Url = host.(string)
-	} else {
+	} else if _, ok := configMap["operations"]; !ok {
 		return nil, fmt.Errorf("config-map must include host")
 	}
 
 	// decimal numbers, each with optional fraction and a unit suffix,
 	// such as "300ms", "-1.5h" or "2h45m".
 	// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
-	if timeout, ok := configMap["timeout"]; ok {
-		dur, err := time.ParseDuration(timeout.(string))
-		if err != nil {
-			return nil, fmt.Errorf("parsing duration faild with err: %v", err)
-		}
-		config.Timeout = dur
-	} else {
-		config.Timeout = 10 * time.Second
+	timeout, err := durationValue(configMap, "timeout", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = timeout
+
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
 	}
 
 	if contentType, ok := configMap["content-type"]; ok {
 		config.ContentType = contentType.(string)
 	} else {
-		config.ContentType = "application/json"
+		config.ContentType = encoder.ContentType()
+	}
+
+	transportMap, err := sectionValue(configMap, "transport")
+	if err != nil {
+		return nil, err
+	}
+	config.Transport, err = ParseHTTPTransportConfig(transportMap)
+	if err != nil {
+		return nil, fmt.Errorf("parsing transport failed with err: %v", err)
+	}
+
+	transport, err := config.Transport.NewTransport()
+	if err != nil {
+		return nil, err
 	}
 
 	client := &http.Client{
-		Timeout: config.Timeout,
+		Timeout:   config.Timeout,
+		Transport: transport,
+	}
+
+	compressionMap, err := sectionValue(configMap, "compression")
+	if err != nil {
+		return nil, err
+	}
+	config.Compression, err = ParseCompressionConfig(compressionMap)
+	if err != nil {
+		return nil, fmt.Errorf("parsing compression failed with err: %v", err)
+	}
+
+	compressor, err := NewCompressor(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	retryMap, err := sectionValue(configMap, "retry")
+	if err != nil {
+		return nil, err
+	}
+	config.Retry, err = ParseRetryConfig(retryMap)
+	if err != nil {
+		return nil, fmt.Errorf("parsing retry failed with err: %v", err)
 	}
 
 	if consumeKafka, ok := configMap["consume-kafka"]; ok {
@@ -83,94 +132,300 @@ func NewHTTPClientFromConfig(configMap map[string]interface{}, rw *waiter.Respon
 		config.ConsumeKafka = true
 	}
 
+	if config.CorrelationHeader, err = stringValue(configMap, "correlation-header", DefaultCorrelationHeader); err != nil {
+		return nil, err
+	}
+
+	opMaps, err := sectionListValue(configMap, "operations")
+	if err != nil {
+		return nil, err
+	}
+	for i, opMap := range opMaps {
+		op, err := ParseHTTPOperation(opMap, config.ConsumeKafka)
+		if err != nil {
+			return nil, fmt.Errorf("parsing operation %d failed with err: %v", i, err)
+		}
+		config.Operations = append(config.Operations, op)
+	}
+	if len(config.Operations) == 0 {
+		// The single url posts the message, like before operations existed
+		config.Operations = []HTTPOperation{{
+			Name:         "ingest",
+			Method:       http.MethodPost,
+			Url:          config.Url,
+			Body:         HTTPBodyMessage,
+			Weight:       1,
+			ExpectStatus: []int{http.StatusOK},
+			Confirm:      config.ConsumeKafka,
+		}}
+	}
+
+	if config.Mode, err = stringValue(configMap, "mode", HTTPModeWeighted); err != nil {
+		return nil, err
+	}
+	operations, err := newOperationPicker(config.Operations, config.Mode)
+	if err != nil {
+		return nil, err
+	}
+
 	return &HTTPClient{
 		Config:         config,
 		Client:         client,
 		ResponseWaiter: rw,
 		JsonFast:       jsoniter.ConfigFastest,
+		Encoder:        encoder,
+		Compressor:     compressor,
+		operations:     operations,
 	}, nil
 }
 
 func (c HTTPClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
 	start := time.Now()
 
-	waiterCh := c.ResponseWaiter.Register(req.DeviceInfo.DeviceID)
+	op := c.operations.pick(req.DeviceInfo.DeviceID)
+
+	var waiterCh chan message.Confirmation
+	if op.Confirm {
+		waiterCh = c.ResponseWaiter.RegisterMessage(req)
+		defer c.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+	}
 
-	b, err := json.Marshal(req)
+	payload, err := c.payload(op, req)
 	if err != nil {
 		return message.Response{
 			Timestamp:   start,
 			Err:         err,
 			Latency:     time.Since(start),
-			MessageSize: -1,
+			MessageSize: payload.size,
+			WireSize:    -1,
+			Operation:   op.Name,
 		}
 	}
 
-	body := bytes.NewReader(b)
-
 	send := time.Now()
-	log.Println(string(b))
 
-	if json.Valid(b) {
-		log.Printf("is valid json")
-	}
+	var res httpAttempt
+	attempts := 0
+	for {
+		attempts++
+		res = c.send(ctx, op, req, payload)
 
-	resp, err := c.Client.Post(c.Config.Url, c.Config.ContentType, body)
-	if err != nil {
-		return message.Response{
-			Timestamp:   start,
-			Err:         err,
-			Latency:     time.Since(start),
-			MessageSize: len(b),
+		if res.Err == nil && op.Expected(res.StatusCode) {
+			break
+		}
+		if attempts >= c.Config.Retry.MaxAttempts || ctx.Err() != nil || !c.Config.Retry.ShouldRetry(res.StatusCode, res.Err) {
+			break
 		}
-	}
 
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(resp.Body)
-	if err != nil {
-		return message.Response{
-			Timestamp:   start,
-			Err:         err,
-			Latency:     time.Since(start),
-			MessageSize: len(b),
+		timer := time.NewTimer(c.Config.Retry.Backoff(attempts, res.Header))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			break
 		}
 	}
 
-	respBodyStr := buf.String()
-
-	if resp.StatusCode != 200 {
+	if res.Err != nil {
 		return message.Response{
-			Timestamp:   start,
-			Err:         fmt.Errorf("recieved statuscode: %d with resp: %v, body: %s", resp.StatusCode, resp.Status, respBodyStr),
-			Latency:     time.Since(start),
-			MessageSize: len(b),
+			Timestamp:          start,
+			Err:                res.Err,
+			Latency:            time.Since(start),
+			MessageSize:        payload.size,
+			WireSize:           len(payload.wire),
+			ConnReused:         res.ConnReused,
+			Attempts:           attempts,
+			LastAttemptLatency: res.Latency,
+			Operation:          op.Name,
+			StatusCode:         res.StatusCode,
+			Body:               res.Body,
 		}
 	}
 
-	// So we can generate load from without the need of consuming from kafka (for the beginning)
-	if c.Config.ConsumeKafka == false {
+	if !op.Expected(res.StatusCode) {
 		return message.Response{
-			Timestamp:   start,
-			Err:         nil,
-			Latency:     time.Since(start),
-			MessageSize: len(b),
+			Timestamp:          start,
+			Err:                fmt.Errorf("recieved statuscode: %d with resp: %v, body: %s", res.StatusCode, res.Status, res.Body),
+			Latency:            time.Since(start),
+			MessageSize:        payload.size,
+			WireSize:           len(payload.wire),
+			ConnReused:         res.ConnReused,
+			Attempts:           attempts,
+			LastAttemptLatency: res.Latency,
+			Operation:          op.Name,
+			StatusCode:         res.StatusCode,
+			Body:               res.Body,
 		}
 	}
 
-	select {
-	case <-waiterCh:
+	ack := time.Now()
+	// So we can generate load from without the need of consuming from kafka (for the beginning),
+	// also if the message has nothing to confirm
+	if waiterCh == nil {
 		return message.Response{
-			Timestamp:   start,
-			Err:         nil,
-			Latency:     time.Since(send),
-			MessageSize: len(b),
+			Timestamp:          start,
+			Err:                nil,
+			Latency:            time.Since(start),
+			MessageSize:        payload.size,
+			WireSize:           len(payload.wire),
+			ConnReused:         res.ConnReused,
+			Attempts:           attempts,
+			LastAttemptLatency: res.Latency,
+			Operation:          op.Name,
+			StatusCode:         res.StatusCode,
+			Body:               res.Body,
+			SendTime:           send,
+			AckTime:            ack,
 		}
-	case <-ctx.Done():
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
 		return message.Response{
-			Timestamp:   start,
-			Err:         fmt.Errorf("context done"),
-			Latency:     time.Since(send),
-			MessageSize: len(b),
+			Timestamp:          start,
+			Err:                err,
+			Latency:            time.Since(send),
+			MessageSize:        payload.size,
+			WireSize:           len(payload.wire),
+			ConnReused:         res.ConnReused,
+			Attempts:           attempts,
+			LastAttemptLatency: res.Latency,
+			Operation:          op.Name,
+			StatusCode:         res.StatusCode,
+			Body:               res.Body,
+			SendTime:           send,
+			AckTime:            ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:          start,
+		Err:                nil,
+		Latency:            time.Since(send),
+		MessageSize:        payload.size,
+		WireSize:           len(payload.wire),
+		ConnReused:         res.ConnReused,
+		Attempts:           attempts,
+		LastAttemptLatency: res.Latency,
+		Operation:          op.Name,
+		StatusCode:         res.StatusCode,
+		Body:               res.Body,
+		SendTime:           send,
+		AckTime:            ack,
+	}.WithConfirmation(conf)
+}
+
+// httpPayload is the request body of one operation
+type httpPayload struct {
+	wire            []byte
+	size            int // before compression, -1 if marshalling failed
+	contentType     string
+	contentEncoding string
+}
+
+func (c HTTPClient) payload(op HTTPOperation, req message.Message) (httpPayload, error) {
+	switch op.Body {
+	case HTTPBodyNone:
+		return httpPayload{}, nil
+	case HTTPBodyTemplate:
+		b := []byte(renderJSONTemplate(op.Template, req))
+		contentType := op.ContentType
+		if contentType == "" {
+			contentType = "application/json"
 		}
+		return httpPayload{wire: b, size: len(b), contentType: contentType}, nil
 	}
+
+	b, err := c.Encoder.Marshal(req)
+	if err != nil {
+		return httpPayload{size: -1}, err
+	}
+
+	wire, err := c.Compressor.Compress(b)
+	if err != nil {
+		return httpPayload{size: len(b)}, fmt.Errorf("compressing payload failed with err: %v", err)
+	}
+
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = c.Config.ContentType
+	}
+	return httpPayload{
+		wire:            wire,
+		size:            len(b),
+		contentType:     contentType,
+		contentEncoding: c.Compressor.ContentEncoding(),
+	}, nil
+}
+
+type httpAttempt struct {
+	StatusCode int // 0 on transport errors
+	Status     string
+	Header     http.Header
+	Body       string
+	Latency    time.Duration
+	ConnReused bool
+	Err        error
+}
+
+// send runs the operation once, the retry loop lives in CallEndpoint
+func (c HTTPClient) send(ctx context.Context, op HTTPOperation, req message.Message, payload httpPayload) httpAttempt {
+	start := time.Now()
+
+	// Tells apart a slow backend from the generator opening new sockets
+	var res httpAttempt
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			res.ConnReused = info.Reused
+		},
+	}
+
+	var body io.Reader
+	if payload.wire != nil {
+		body = bytes.NewReader(payload.wire)
+	}
+
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), op.Method, op.URL(req), body)
+	if err != nil {
+		res.Err = err
+		res.Latency = time.Since(start)
+		return res
+	}
+	for name := range op.Headers {
+		httpReq.Header.Set(name, renderTemplate(op.Headers.Get(name), req))
+	}
+	if payload.contentType != "" {
+		httpReq.Header.Set("Content-Type", payload.contentType)
+	}
+	if payload.contentEncoding != "" {
+		httpReq.Header.Set("Content-Encoding", payload.contentEncoding)
+	}
+	if c.Config.CorrelationHeader != "" {
+		httpReq.Header.Set(c.Config.CorrelationHeader, req.CorrelationID())
+	}
+
+	resp, err := c.Client.Do(httpReq)
+	if err != nil {
+		res.Err = err
+		res.Latency = time.Since(start)
+		return res
+	}
+	defer resp.Body.Close()
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(resp.Body)
+	res.Latency = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.StatusCode = resp.StatusCode
+	res.Status = resp.Status
+	res.Header = resp.Header
+	res.Body = buf.String()
+
+	return res
 }
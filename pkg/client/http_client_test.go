@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+)
+
+func newTestServer(t *testing.T, h2c bool) (*httptest.Server, chan string) {
+	protos := make(chan string, 16)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.Proto
+		w.WriteHeader(http.StatusOK)
+	}))
+	if h2c {
+		srv.Config.Protocols = new(http.Protocols)
+		srv.Config.Protocols.SetHTTP1(true)
+		srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv, protos
+}
+
+func TestHTTPClient_ConnReused(t *testing.T) {
+	srv, _ := newTestServer(t, false)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 100)
+
+	first := cl.CallEndpoint(context.Background(), provider.GetData())
+	if first.Err != nil {
+		t.Fatal(first.Err)
+	}
+	if first.ConnReused {
+		t.Fatalf("first request can not reuse a connection")
+	}
+
+	second := cl.CallEndpoint(context.Background(), provider.GetData())
+	if second.Err != nil {
+		t.Fatal(second.Err)
+	}
+	if !second.ConnReused {
+		t.Fatalf("expected second request to reuse the connection")
+	}
+}
+
+func TestHTTPClient_KeepAliveDisabled(t *testing.T) {
+	srv, _ := newTestServer(t, false)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+		"transport": map[string]interface{}{
+			"keep-alive": false,
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 100)
+	for i := 0; i < 2; i++ {
+		resp := cl.CallEndpoint(context.Background(), provider.GetData())
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+		if resp.ConnReused {
+			t.Fatalf("request %d reused a connection with keep-alive disabled", i)
+		}
+	}
+}
+
+func TestHTTPClient_H2C(t *testing.T) {
+	srv, protos := newTestServer(t, true)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+		"transport": map[string]interface{}{
+			"protocol": "h2c",
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 100).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if proto := <-protos; proto != "HTTP/2.0" {
+		t.Fatalf("expected HTTP/2.0, got: %s", proto)
+	}
+}
+
+func TestHTTPClient_Compression(t *testing.T) {
+	for _, algorithm := range []string{CompressionGzip, CompressionDeflate, CompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			encodings := make(chan string, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encodings <- r.Header.Get("Content-Encoding")
+				w.WriteHeader(http.StatusOK)
+			}))
+			t.Cleanup(srv.Close)
+
+			cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+				"url":           srv.URL,
+				"consume-kafka": false,
+				"compression": map[string]interface{}{
+					"algorithm": algorithm,
+				},
+			}, waiter.NewResponseWaiter())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 10000).GetData())
+			if resp.Err != nil {
+				t.Fatal(resp.Err)
+			}
+			if encoding := <-encodings; encoding != algorithm {
+				t.Fatalf("expected Content-Encoding %s, got: %s", algorithm, encoding)
+			}
+			if resp.WireSize <= 0 || resp.WireSize >= resp.MessageSize {
+				t.Fatalf("expected compressed wire-size below message-size %d, got: %d", resp.MessageSize, resp.WireSize)
+			}
+		})
+	}
+}
+
+func TestHTTPClient_Retry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+		"retry": map[string]interface{}{
+			"max-attempts":    uint64(5),
+			"initial-backoff": "1ms",
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 100).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Attempts != 3 {
+		t.Fatalf("expected 3 attempts, got: %d", resp.Attempts)
+	}
+	if resp.LastAttemptLatency > resp.Latency {
+		t.Fatalf("last attempt latency %v exceeds total latency %v", resp.LastAttemptLatency, resp.Latency)
+	}
+}
+
+func TestHTTPClient_RetryNotOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(srv.Close)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+		"retry": map[string]interface{}{
+			"max-attempts": uint64(5),
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 100).GetData())
+	if resp.Err == nil {
+		t.Fatalf("expected error for status 400")
+	}
+	if resp.Attempts != 1 || calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got: %d (server saw %d)", resp.Attempts, calls.Load())
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	conf, err := ParseRetryConfig(map[string]interface{}{
+		"initial-backoff": "100ms",
+		"max-backoff":     "1s",
+		"jitter":          float64(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, want := range expected {
+		if got := conf.Backoff(i+1, http.Header{}); got != want {
+			t.Fatalf("attempt %d: expected backoff %v, got: %v", i+1, want, got)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "0")
+	if got := conf.Backoff(3, header); got != 0 {
+		t.Fatalf("expected Retry-After to be honoured, got: %v", got)
+	}
+	header.Set("Retry-After", "86400")
+	if got := conf.Backoff(1, header); got != time.Second {
+		t.Fatalf("expected Retry-After to be capped at max-backoff, got: %v", got)
+	}
+}
+
+func TestHTTPClient_OperationSequence(t *testing.T) {
+	calls := make(chan string, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- r.Method + " " + r.URL.Path + " " + string(body)
+		if r.URL.Path == "/devices" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"mode":          "sequence",
+		"consume-kafka": false,
+		"operations": []interface{}{
+			map[string]interface{}{"name": "ingest", "url": srv.URL + "/ingest", "weight": uint64(2)},
+			map[string]interface{}{"name": "summary", "method": "GET", "url": srv.URL + "/summary/{deviceId}"},
+			map[string]interface{}{
+				"name":          "register",
+				"url":           srv.URL + "/devices",
+				"body":          "template",
+				"template":      `{"deviceId":"{deviceId}"}`,
+				"expect-status": []interface{}{uint64(201)},
+			},
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 100)
+	msg := provider.GetData()
+	other := provider.GetData()
+	other.DeviceInfo.DeviceID = "other-device"
+
+	want := []string{"ingest", "ingest", "summary", "register", "ingest"}
+	for _, name := range want {
+		resp := cl.CallEndpoint(context.Background(), msg)
+		if resp.Err != nil {
+			t.Fatalf("%s: %v", name, resp.Err)
+		}
+		if resp.Operation != name {
+			t.Fatalf("expected operation %s, got %s", name, resp.Operation)
+		}
+
+		call := <-calls
+		switch name {
+		case "summary":
+			if call != "GET /summary/"+msg.DeviceInfo.DeviceID+" " {
+				t.Fatalf("unexpected summary call: %s", call)
+			}
+		case "register":
+			if call != `POST /devices {"deviceId":"`+msg.DeviceInfo.DeviceID+`"}` {
+				t.Fatalf("unexpected register call: %s", call)
+			}
+		}
+
+		// Calls of another device don't advance the cycle of msg
+		if resp := cl.CallEndpoint(context.Background(), other); resp.Operation != name {
+			t.Fatalf("expected operation %s for the other device, got %s", name, resp.Operation)
+		}
+		<-calls
+	}
+}
+
+func TestHTTPClient_CorrelationHeader(t *testing.T) {
+	ids := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get(DefaultCorrelationHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	cl, err := NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           srv.URL,
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := message.NewProvider(1, 100).GetData()
+	if resp := cl.CallEndpoint(context.Background(), req); resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if got := <-ids; got == "" || got != req.MessageID {
+		t.Fatalf("expected header %q, got %q", req.MessageID, got)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"wplug/pkg/message"
+)
+
+// Config:
+// client:
+//	type: http
+//	config:
+//		mode: weighted # weighted (random by weight), sequence (weight = repetitions in a fixed cycle per device)
+//		operations: # replaces url, the top-level settings apply to every operation
+//			- name: ingest
+//			  url: "https://wearables.cherep.co/import/ingest"
+//			  weight: 8
+//			- name: daily-summary
+//			  method: GET
+//			  url: "https://wearables.cherep.co/summary/{deviceId}/daily" # see template.go, values are path escaped
+//			  weight: 2
+//			- name: register-device
+//			  url: "https://wearables.cherep.co/devices"
+//			  body: template # message, template, none
+//			  template: '{"deviceId":"{deviceId}","platform":"{platform}"}' # values are json escaped
+//			  expect-status: [200, 201]
+//			  headers:
+//				X-Api-Key: "..."
+//			  weight: 1
+//---
+
+const (
+	HTTPBodyMessage  = "message"
+	HTTPBodyTemplate = "template"
+	HTTPBodyNone     = "none"
+
+	HTTPModeWeighted = "weighted"
+	HTTPModeSequence = "sequence"
+)
+
+type HTTPOperation struct {
+	Name         string
+	Method       string
+	Url          string
+	Body         string
+	Template     string
+	ContentType  string // defaults to the encoder for message bodies and json for templates
+	Headers      http.Header
+	Weight       int
+	ExpectStatus []int
+	// Only message bodies are confirmed by the kafka consumer
+	Confirm bool
+}
+
+// ParseHTTPOperation reads one entry of `operations:`, confirm defaults to consume-kafka.
+func ParseHTTPOperation(configMap map[string]interface{}, consumeKafka bool) (HTTPOperation, error) {
+	var op HTTPOperation
+	var err error
+
+	if op.Url, err = stringValue(configMap, "url", ""); err != nil {
+		return op, err
+	}
+	if op.Url == "" {
+		return op, fmt.Errorf("operation must include url")
+	}
+	if op.Name, err = stringValue(configMap, "name", op.Url); err != nil {
+		return op, err
+	}
+
+	method, err := stringValue(configMap, "method", http.MethodPost)
+	if err != nil {
+		return op, err
+	}
+	op.Method = strings.ToUpper(method)
+
+	defaultBody := HTTPBodyMessage
+	if op.Method == http.MethodGet || op.Method == http.MethodHead || op.Method == http.MethodDelete {
+		defaultBody = HTTPBodyNone
+	}
+	body, err := stringValue(configMap, "body", defaultBody)
+	if err != nil {
+		return op, err
+	}
+	op.Body = strings.ToLower(body)
+
+	switch op.Body {
+	case HTTPBodyMessage, HTTPBodyNone:
+	case HTTPBodyTemplate:
+		if op.Template, err = stringValue(configMap, "template", ""); err != nil {
+			return op, err
+		}
+	default:
+		return op, fmt.Errorf("body must be one of message, template, none, is: %s", body)
+	}
+
+	if op.ContentType, err = stringValue(configMap, "content-type", ""); err != nil {
+		return op, err
+	}
+	if op.Headers, err = headerValue(configMap, "headers"); err != nil {
+		return op, err
+	}
+	if op.Weight, err = intValue(configMap, "weight", 1); err != nil {
+		return op, err
+	}
+	if op.Weight < 1 {
+		return op, fmt.Errorf("weight of %s must be at least 1, is: %d", op.Name, op.Weight)
+	}
+	if op.ExpectStatus, err = intSliceValue(configMap, "expect-status", []int{http.StatusOK}); err != nil {
+		return op, err
+	}
+	if op.Confirm, err = boolValue(configMap, "confirm", consumeKafka && op.Body == HTTPBodyMessage); err != nil {
+		return op, err
+	}
+	if op.Confirm && op.Body != HTTPBodyMessage {
+		return op, fmt.Errorf("operation %s can only be confirmed with a message body", op.Name)
+	}
+
+	return op, nil
+}
+
+func (op HTTPOperation) Expected(statusCode int) bool {
+	return slices.Contains(op.ExpectStatus, statusCode)
+}
+
+// URL fills the placeholders of the operation url.
+func (op HTTPOperation) URL(msg message.Message) string {
+	return renderURLTemplate(op.Url, msg)
+}
+
+// operationPicker chooses the operation of each call.
+type operationPicker struct {
+	operations []HTTPOperation
+	mode       string
+	total      int
+	// sequence: device id -> *atomic.Uint64, every device runs through the cycle on its own
+	next *sync.Map
+}
+
+func newOperationPicker(operations []HTTPOperation, mode string) (operationPicker, error) {
+	if mode != HTTPModeWeighted && mode != HTTPModeSequence {
+		return operationPicker{}, fmt.Errorf("mode must be one of weighted, sequence, is: %s", mode)
+	}
+
+	total := 0
+	for _, op := range operations {
+		total += op.Weight
+	}
+
+	return operationPicker{
+		operations: operations,
+		mode:       mode,
+		total:      total,
+		next:       new(sync.Map),
+	}, nil
+}
+
+func (p operationPicker) pick(deviceID string) HTTPOperation {
+	if len(p.operations) == 1 {
+		return p.operations[0]
+	}
+
+	var n int
+	if p.mode == HTTPModeSequence {
+		cursor, ok := p.next.Load(deviceID)
+		if !ok {
+			cursor, _ = p.next.LoadOrStore(deviceID, new(atomic.Uint64))
+		}
+		n = int((cursor.(*atomic.Uint64).Add(1) - 1) % uint64(p.total))
+	} else {
+		n = rand.IntN(p.total)
+	}
+
+	for _, op := range p.operations {
+		if n < op.Weight {
+			return op
+		}
+		n -= op.Weight
+	}
+	return p.operations[len(p.operations)-1]
+}
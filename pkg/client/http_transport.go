@@ -0,0 +1,132 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config:
+// client:
+//	type: http
+//	config:
+//		url: "https://host/import/ingest"
+//		transport:
+//			max-idle-conns: 100
+//			max-idle-conns-per-host: 100
+//			max-conns-per-host: 0 # 0 = unlimited
+//			idle-conn-timeout: 90s
+//			keep-alive: true
+//			protocol: auto # auto, http1, http2, h2c
+//			dial-timeout: 5s
+//			tls:
+//				insecure-skip-verify: true
+//---
+
+const (
+	ProtocolAuto  = "auto"
+	ProtocolHTTP1 = "http1"
+	ProtocolHTTP2 = "http2"
+	ProtocolH2C   = "h2c"
+)
+
+type HTTPTransportConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	KeepAlive           bool
+	Protocol            string
+	DialTimeout         time.Duration
+	TLS                 TLSConfig
+}
+
+func ParseHTTPTransportConfig(configMap map[string]interface{}) (HTTPTransportConfig, error) {
+	var config HTTPTransportConfig
+	var err error
+
+	// Defaults mirror http.DefaultTransport
+	if config.MaxIdleConns, err = intValue(configMap, "max-idle-conns", 100); err != nil {
+		return config, err
+	}
+	if config.MaxIdleConnsPerHost, err = intValue(configMap, "max-idle-conns-per-host", http.DefaultMaxIdleConnsPerHost); err != nil {
+		return config, err
+	}
+	if config.MaxConnsPerHost, err = intValue(configMap, "max-conns-per-host", 0); err != nil {
+		return config, err
+	}
+	if config.IdleConnTimeout, err = durationValue(configMap, "idle-conn-timeout", 90*time.Second); err != nil {
+		return config, err
+	}
+	if config.KeepAlive, err = boolValue(configMap, "keep-alive", true); err != nil {
+		return config, err
+	}
+	if config.DialTimeout, err = durationValue(configMap, "dial-timeout", 30*time.Second); err != nil {
+		return config, err
+	}
+
+	protocol, err := stringValue(configMap, "protocol", ProtocolAuto)
+	if err != nil {
+		return config, err
+	}
+	config.Protocol = strings.ToLower(protocol)
+	switch config.Protocol {
+	case ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C:
+	default:
+		return config, fmt.Errorf("protocol must be one of auto, http1, http2, h2c, is: %s", protocol)
+	}
+
+	tlsMap, err := sectionValue(configMap, "tls")
+	if err != nil {
+		return config, err
+	}
+	if config.TLS, err = ParseTLSConfig(tlsMap); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func (c HTTPTransportConfig) NewTransport() (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   c.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       c.IdleConnTimeout,
+		DisableKeepAlives:     !c.KeepAlive,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	tlsConfig, err := c.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	protocols := new(http.Protocols)
+	switch c.Protocol {
+	case ProtocolAuto:
+		transport.ForceAttemptHTTP2 = true
+		protocols = nil
+	case ProtocolHTTP1:
+		protocols.SetHTTP1(true)
+	case ProtocolHTTP2:
+		protocols.SetHTTP2(true)
+	case ProtocolH2C:
+		// HTTP/2 with prior knowledge over plain tcp
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	transport.Protocols = protocols
+
+	return transport, nil
+}
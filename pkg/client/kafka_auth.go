@@ -0,0 +1,111 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Config:
+// kafka:
+//	tls: # see tls.go
+//		enabled: true
+//		ca-file: "ca.pem"
+//	sasl:
+//		mechanism: scram-sha-512 # plain, scram-sha-256, scram-sha-512
+//		username: "wplug" # or username-env / username-file
+//		password-env: "KAFKA_PASSWORD" # or password-file, never inline
+//---
+
+const (
+	SASLPlain        = "plain"
+	SASLScramSHA256  = "scram-sha-256"
+	SASLScramSHA512  = "scram-sha-512"
+	kafkaDialTimeout = 10 * time.Second
+)
+
+type KafkaSASLConfig struct {
+	Mechanism    string `yaml:"mechanism"`
+	Username     string `yaml:"username"`
+	UsernameEnv  string `yaml:"username-env"`
+	UsernameFile string `yaml:"username-file"`
+	PasswordEnv  string `yaml:"password-env"`
+	PasswordFile string `yaml:"password-file"`
+}
+
+// Build resolves the credentials, it returns nil if no mechanism is configured.
+func (c KafkaSASLConfig) Build() (sasl.Mechanism, error) {
+	if c.Mechanism == "" {
+		return nil, nil
+	}
+
+	username, err := secretValue("username", c.Username, c.UsernameEnv, c.UsernameFile)
+	if err != nil {
+		return nil, err
+	}
+	password, err := secretValue("password", "", c.PasswordEnv, c.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("sasl needs a username and a password")
+	}
+
+	switch strings.ToLower(c.Mechanism) {
+	case SASLPlain:
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, username, password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("sasl mechanism must be one of plain, scram-sha-256, scram-sha-512, is: %s", c.Mechanism)
+	}
+}
+
+// kafkaDialer applies tls and sasl, it is used for the readers and the partition lookup.
+func kafkaDialer(tlsConf TLSConfig, saslConf KafkaSASLConfig) (*kafka.Dialer, error) {
+	tlsConfig, err := tlsConf.Build()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := saslConf.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       kafkaDialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// secretValue takes the first of value, the env var and the file that is set.
+func secretValue(name string, value string, env string, file string) (string, error) {
+	switch {
+	case value != "":
+		return value, nil
+	case env != "":
+		v := os.Getenv(env)
+		if v == "" {
+			return "", fmt.Errorf("%s: env var %s is empty", name, env)
+		}
+		return v, nil
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading %s file failed with err: %v", name, err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
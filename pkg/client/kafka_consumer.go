@@ -2,7 +2,11 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 	"wplug/pkg/message"
 	"wplug/pkg/waiter"
 
@@ -11,64 +15,285 @@ import (
 	//franz "github.com/twmb/franz-go/pkg/kgo"
 )
 
+// Config:
+// kafka:
+//	enabled: true
+//	topic: "processed"
+//	brokers: ["localhost:9094"]
+//	max-bytes: 1000000
+//	group-id: "" # consumer group mode, the partitions are assigned by the group
+//	partitions: [] # without group-id: the partitions to read, empty = all
+//	start-offset: latest # latest (run start), earliest; a group resumes at its committed offset
+//	tls: ... # see kafka_auth.go
+//	sasl: ...
+//	correlation: ... # see correlation.go
+//	stages: # replaces topic and correlation, a message is confirmed when it reaches the last stage
+//		- name: raw
+//		  topic: "raw"
+//		- name: validated
+//		  topic: "validated"
+//		  correlation:
+//			header: "correlation-id"
+//		- name: aggregated
+//		  topic: "aggregated"
+//		  correlation:
+//			json-path: "meta.messageId"
+//---
+
+const (
+	StartOffsetLatest   = "latest"
+	StartOffsetEarliest = "earliest"
+)
+
 type KafkaConsumerConfig struct {
-	Enabled   bool     `yaml:"enabled"`
-	Topic     string   `yaml:"topic"`
-	Partition int      `yaml:"partition"`
-	MaxBytes  int      `yaml:"max-bytes"`
-	Brokers   []string `yaml:"brokers"`
+	Enabled bool   `yaml:"enabled"`
+	Topic   string `yaml:"topic"`
+	// Deprecated: reads only this partition, use partitions
+	Partition   *int               `yaml:"partition"`
+	Partitions  []int              `yaml:"partitions"`
+	GroupID     string             `yaml:"group-id"`
+	StartOffset string             `yaml:"start-offset"`
+	MaxBytes    int                `yaml:"max-bytes"`
+	Brokers     []string           `yaml:"brokers"`
+	TLS         TLSConfig          `yaml:"tls"`
+	SASL        KafkaSASLConfig    `yaml:"sasl"`
+	Correlation CorrelationConfig  `yaml:"correlation"`
+	Stages      []KafkaStageConfig `yaml:"stages"`
+}
+
+// KafkaStageConfig is one topic of a multi-stage pipeline, partitions apply to every stage.
+type KafkaStageConfig struct {
+	Name        string            `yaml:"name"`
+	Topic       string            `yaml:"topic"`
+	Correlation CorrelationConfig `yaml:"correlation"`
 }
 
 type KafkaConsumer struct {
-	Reader         *kafka.Reader
+	Config         KafkaConsumerConfig
 	ResponseWaiter *waiter.ResponseWaiter
-	Config         kafka.ReaderConfig
 	jsonFast       jsoniter.API
+	dialer         *kafka.Dialer
 }
 
-func NewKafkaConsumer(rw *waiter.ResponseWaiter, topic string, partition int, maxBytes int, brokers ...string) *KafkaConsumer {
-	config := kafka.ReaderConfig{
-		Brokers:   brokers,
-		Topic:     topic,
-		Partition: partition,
-		MaxBytes:  maxBytes,
+func NewKafkaConsumer(rw *waiter.ResponseWaiter, config KafkaConsumerConfig) (*KafkaConsumer, error) {
+	if config.Topic != "" && len(config.Stages) > 0 {
+		return nil, fmt.Errorf("topic and stages can't be used together")
+	}
+	if config.Correlation != (CorrelationConfig{}) && len(config.Stages) > 0 {
+		return nil, fmt.Errorf("correlation and stages can't be used together, set the correlation per stage")
+	}
+	multiStage := len(config.Stages) > 0
+	if !multiStage {
+		if config.Topic == "" {
+			return nil, fmt.Errorf("kafka consumer needs a topic")
+		}
+		config.Stages = []KafkaStageConfig{{Name: config.Topic, Topic: config.Topic, Correlation: config.Correlation}}
+	}
+
+	topics := make(map[string]bool, len(config.Stages))
+	for i := range config.Stages {
+		stage := &config.Stages[i]
+		if stage.Topic == "" {
+			return nil, fmt.Errorf("stage %d needs a topic", i)
+		}
+		if topics[stage.Topic] {
+			return nil, fmt.Errorf("topic %s is used by more than one stage", stage.Topic)
+		}
+		topics[stage.Topic] = true
+		if stage.Name == "" {
+			stage.Name = stage.Topic
+		}
+	}
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka consumer needs at least one broker")
+	}
+
+	config.StartOffset = strings.ToLower(config.StartOffset)
+	if config.StartOffset == "" {
+		config.StartOffset = StartOffsetLatest
+	}
+	if config.StartOffset != StartOffsetLatest && config.StartOffset != StartOffsetEarliest {
+		return nil, fmt.Errorf("start-offset must be one of latest, earliest, is: %s", config.StartOffset)
+	}
+
+	if config.Partition != nil {
+		if len(config.Partitions) > 0 {
+			return nil, fmt.Errorf("partition and partitions can't be used together")
+		}
+		log.Printf("kafka: partition is deprecated, use partitions: [%d]", *config.Partition)
+		config.Partitions = []int{*config.Partition}
+	}
+	if config.GroupID != "" && len(config.Partitions) > 0 {
+		return nil, fmt.Errorf("partitions can't be used with group-id, the group assigns them")
+	}
+
+	// Fails early on missing credentials instead of in the consumer goroutine
+	dialer, err := kafkaDialer(config.TLS, config.SASL)
+	if err != nil {
+		return nil, err
+	}
+
+	if multiStage {
+		names := make([]string, len(config.Stages))
+		for i, stage := range config.Stages {
+			names[i] = stage.Name
+		}
+		rw.SetStages(names...)
 	}
 
 	return &KafkaConsumer{
 		Config:         config,
 		ResponseWaiter: rw,
 		jsonFast:       jsoniter.ConfigFastest,
-	}
+		dialer:         dialer,
+	}, nil
 }
 
 func (kc *KafkaConsumer) Start(ctx context.Context) {
 	go func() {
+		readers, err := kc.readers(ctx)
+		if err != nil {
+			log.Printf("creating kafka readers failed with err: %v", err)
+			return
+		}
 
-		reader := kafka.NewReader(kc.Config)
-		defer func() {
-			err := reader.Close()
-			if err != nil {
-				log.Fatalf("closing reader failed with err: %v", err)
-			}
-		}()
+		stages := make(map[string]int, len(kc.Config.Stages))
+		for i, stage := range kc.Config.Stages {
+			stages[stage.Topic] = i
+		}
 
-		log.Printf("reader stats: %v", reader.Stats())
+		var wg sync.WaitGroup
+		for _, reader := range readers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				kc.consume(ctx, reader, stages)
+			}()
+		}
+		wg.Wait()
+	}()
+}
+
+// readers returns one group reader for all stage topics, or one reader per topic and partition.
+func (kc *KafkaConsumer) readers(ctx context.Context) ([]*kafka.Reader, error) {
+	startOffset := kafka.LastOffset
+	if kc.Config.StartOffset == StartOffsetEarliest {
+		startOffset = kafka.FirstOffset
+	}
+
+	if kc.Config.GroupID != "" {
+		topics := make([]string, len(kc.Config.Stages))
+		for i, stage := range kc.Config.Stages {
+			topics[i] = stage.Topic
+		}
+
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     kc.Config.Brokers,
+			GroupTopics: topics,
+			GroupID:     kc.Config.GroupID,
+			Dialer:      kc.dialer,
+			StartOffset: startOffset,
+			MaxBytes:    kc.Config.MaxBytes,
+			// Synchronous commits would slow down every confirmation
+			CommitInterval: time.Second,
+		})
+		return []*kafka.Reader{reader}, nil
+	}
 
-		for {
-			m, err := reader.ReadMessage(ctx)
-			if err != nil {
-				log.Printf("kafka read error: %v", err)
-				continue
+	var readers []*kafka.Reader
+	for _, stage := range kc.Config.Stages {
+		partitions := kc.Config.Partitions
+		if len(partitions) == 0 {
+			var err error
+			if partitions, err = kc.lookupPartitions(ctx, stage.Topic); err != nil {
+				return nil, err
 			}
-			// m.Time is the Ts when the message is written into kafka
-			var msg message.Message
-			if err := kc.jsonFast.Unmarshal(m.Value, &msg); err != nil {
-				log.Printf("unmarshalling json failed with err: %v", err)
-				continue
+		}
+		log.Printf("kafka: reading partitions %v of %s", partitions, stage.Topic)
+
+		for _, partition := range partitions {
+			reader := kafka.NewReader(kafka.ReaderConfig{
+				Brokers:   kc.Config.Brokers,
+				Topic:     stage.Topic,
+				Partition: partition,
+				MaxBytes:  kc.Config.MaxBytes,
+				Dialer:    kc.dialer,
+			})
+			// Partition readers ignore StartOffset and begin at the first offset
+			if err := reader.SetOffset(startOffset); err != nil {
+				return nil, fmt.Errorf("setting offset of partition %d of %s failed with err: %v", partition, stage.Topic, err)
 			}
+			readers = append(readers, reader)
+		}
+	}
+
+	return readers, nil
+}
+
+func (kc *KafkaConsumer) lookupPartitions(ctx context.Context, topic string) ([]int, error) {
+	var lastErr error
+	for _, broker := range kc.Config.Brokers {
+		found, err := kc.dialer.LookupPartitions(ctx, "tcp", broker, topic)
+		if err != nil {
+			lastErr = err
+			continue
+		}
 
-			kc.ResponseWaiter.Deliver(msg)
+		partitions := make([]int, 0, len(found))
+		for _, p := range found {
+			partitions = append(partitions, p.ID)
 		}
+		return partitions, nil
+	}
+
+	return nil, fmt.Errorf("looking up partitions of %s failed with err: %v", topic, lastErr)
+}
 
+// consume delivers every message as the stage of its topic.
+func (kc *KafkaConsumer) consume(ctx context.Context, reader *kafka.Reader, stages map[string]int) {
+	defer func() {
+		err := reader.Close()
+		if err != nil {
+			log.Fatalf("closing reader failed with err: %v", err)
+		}
 	}()
+
+	for {
+		m, err := reader.ReadMessage(ctx)
+		received := time.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("kafka read error: %v", err)
+			continue
+		}
+		// m.Time is the Ts when the message is written into kafka
+		var msg message.Message
+		if err := kc.jsonFast.Unmarshal(m.Value, &msg); err != nil {
+			log.Printf("unmarshalling json failed with err: %v", err)
+			continue
+		}
+
+		stage, ok := stages[m.Topic]
+		if !ok {
+			log.Printf("kafka: message of unknown topic %s", m.Topic)
+			continue
+		}
+
+		header := func(name string) string {
+			for _, h := range m.Headers {
+				if strings.EqualFold(h.Key, name) {
+					return string(h.Value)
+				}
+			}
+			return ""
+		}
+		key := kc.Config.Stages[stage].Correlation.Key(m.Value, header, msg)
+		kc.ResponseWaiter.DeliverStage(key, stage, message.Confirmation{
+			Message:     msg,
+			AppendTime:  m.Time,
+			ReceiveTime: received,
+		})
+	}
 }
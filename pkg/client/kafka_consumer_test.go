@@ -0,0 +1,125 @@
+package client
+
+import (
+	"os"
+	"path"
+	"testing"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func TestNewKafkaConsumer_Config(t *testing.T) {
+	rw := waiter.NewResponseWaiter()
+	partition := 3
+
+	kc, err := NewKafkaConsumer(rw, KafkaConsumerConfig{Topic: "processed", Brokers: []string{"localhost:9094"}, Partition: &partition})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kc.Config.Partitions) != 1 || kc.Config.Partitions[0] != 3 {
+		t.Fatalf("deprecated partition not mapped: %v", kc.Config.Partitions)
+	}
+	if kc.Config.StartOffset != StartOffsetLatest {
+		t.Fatalf("expected latest as default start offset, got %s", kc.Config.StartOffset)
+	}
+
+	invalid := []KafkaConsumerConfig{
+		{Topic: "processed", Brokers: []string{"localhost:9094"}, GroupID: "wplug", Partitions: []int{0}},
+		{Topic: "processed", Brokers: []string{"localhost:9094"}, StartOffset: "yesterday"},
+		{Topic: "processed"},
+		{Brokers: []string{"localhost:9094"}, Correlation: CorrelationConfig{Header: "correlation-id"}, Stages: []KafkaStageConfig{{Topic: "raw"}}},
+	}
+	for _, config := range invalid {
+		if _, err := NewKafkaConsumer(rw, config); err == nil {
+			t.Fatalf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestKafkaSASLConfig_Credentials(t *testing.T) {
+	passwordFile := path.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WPLUG_KAFKA_USER", "wplug")
+
+	mechanism, err := KafkaSASLConfig{
+		Mechanism:    "SCRAM-SHA-512",
+		UsernameEnv:  "WPLUG_KAFKA_USER",
+		PasswordFile: passwordFile,
+	}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mechanism.Name() != "SCRAM-SHA-512" {
+		t.Fatalf("unexpected mechanism: %s", mechanism.Name())
+	}
+
+	plainMechanism, err := KafkaSASLConfig{Mechanism: "plain", Username: "wplug", PasswordFile: passwordFile}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := plainMechanism.(plain.Mechanism); p.Password != "from-file" {
+		t.Fatalf("trailing newline not trimmed: %q", p.Password)
+	}
+
+	if _, err := (KafkaSASLConfig{Mechanism: "plain", Username: "wplug", PasswordEnv: "WPLUG_UNSET_PASSWORD"}).Build(); err == nil {
+		t.Fatal("expected an error for an empty password env var")
+	}
+}
+
+func TestCorrelationConfig_Key(t *testing.T) {
+	msg := message.NewProvider(1, 100).GetData()
+	value := []byte(`{"meta":{"messageId":"from-body"}}`)
+	header := func(name string) string {
+		if name == CorrelationHeader {
+			return "from-header"
+		}
+		return ""
+	}
+
+	cases := []struct {
+		config CorrelationConfig
+		want   string
+	}{
+		{CorrelationConfig{}, msg.MessageID},
+		{CorrelationConfig{Header: CorrelationHeader}, "from-header"},
+		{CorrelationConfig{JSONPath: "meta.messageId"}, "from-body"},
+		{CorrelationConfig{Header: "x-missing", JSONPath: "meta.messageId"}, "from-body"},
+		{CorrelationConfig{JSONPath: "meta.missing"}, msg.MessageID},
+	}
+	for _, c := range cases {
+		if got := c.config.Key(value, header, msg); got != c.want {
+			t.Fatalf("%+v: expected key %q, got %q", c.config, c.want, got)
+		}
+	}
+}
+
+func TestNewKafkaConsumer_Stages(t *testing.T) {
+	rw := waiter.NewResponseWaiter()
+	brokers := []string{"localhost:9094"}
+
+	kc, err := NewKafkaConsumer(rw, KafkaConsumerConfig{Brokers: brokers, Stages: []KafkaStageConfig{
+		{Topic: "raw"},
+		{Name: "done", Topic: "aggregated", Correlation: CorrelationConfig{Header: CorrelationHeader}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kc.Config.Stages[0].Name != "raw" || kc.Config.Stages[1].Name != "done" {
+		t.Fatalf("unexpected stage names: %+v", kc.Config.Stages)
+	}
+
+	invalid := []KafkaConsumerConfig{
+		{Brokers: brokers, Topic: "processed", Stages: []KafkaStageConfig{{Topic: "raw"}}},
+		{Brokers: brokers, Stages: []KafkaStageConfig{{Topic: "raw"}, {Topic: "raw"}}},
+		{Brokers: brokers, Stages: []KafkaStageConfig{{Name: "raw"}}},
+	}
+	for _, config := range invalid {
+		if _, err := NewKafkaConsumer(rw, config); err == nil {
+			t.Fatalf("expected an error for %+v", config)
+		}
+	}
+}
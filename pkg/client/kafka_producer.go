@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+)
+
+// Config:
+// client:
+//	type: kafka
+//	config:
+//		brokers: ["localhost:9094"]
+//		topic: "raw"
+//		key: device-id # device-id, message-id, none
+//		# the message id is always sent in the correlation-id header, see correlation.go
+//		acks: all # none, one, all
+//		batch-size: 100
+//		batch-timeout: 10ms
+//		compression-codec: none # none, gzip, snappy, lz4, zstd
+//		partitioner: hash # hash, round-robin, least-bytes, crc32, murmur2
+//		write-timeout: 10s
+//		encoding: json
+//		consume-kafka: true
+//---
+
+type KafkaProducerConfig struct {
+	Brokers          []string
+	Topic            string
+	Key              string
+	Acks             string
+	BatchSize        int
+	BatchTimeout     time.Duration
+	CompressionCodec string
+	Partitioner      string
+	WriteTimeout     time.Duration
+	ConsumeKafka     bool
+}
+
+type KafkaProducer struct {
+	Config         KafkaProducerConfig
+	Writer         *kafka.Writer
+	ResponseWaiter *waiter.ResponseWaiter
+	encoder        Encoder
+}
+
+func NewKafkaProducer(configMap map[string]interface{}, rw *waiter.ResponseWaiter) (*KafkaProducer, error) {
+	var config KafkaProducerConfig
+	var err error
+
+	if config.Brokers, err = stringSliceValue(configMap, "brokers", nil); err != nil {
+		return nil, err
+	}
+	if config.Topic, err = stringValue(configMap, "topic", ""); err != nil {
+		return nil, err
+	}
+	if len(config.Brokers) == 0 || config.Topic == "" {
+		return nil, fmt.Errorf("required fields: brokers, topic")
+	}
+	if config.Key, err = stringValue(configMap, "key", "device-id"); err != nil {
+		return nil, err
+	}
+	if config.Acks, err = stringValue(configMap, "acks", "all"); err != nil {
+		return nil, err
+	}
+	if config.BatchSize, err = intValue(configMap, "batch-size", 100); err != nil {
+		return nil, err
+	}
+	if config.BatchTimeout, err = durationValue(configMap, "batch-timeout", 10*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.CompressionCodec, err = stringValue(configMap, "compression-codec", "none"); err != nil {
+		return nil, err
+	}
+	if config.Partitioner, err = stringValue(configMap, "partitioner", "hash"); err != nil {
+		return nil, err
+	}
+	if config.WriteTimeout, err = durationValue(configMap, "write-timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.ConsumeKafka, err = boolValue(configMap, "consume-kafka", true); err != nil {
+		return nil, err
+	}
+
+	if config.Key != "device-id" && config.Key != "message-id" && config.Key != "none" {
+		return nil, fmt.Errorf("key must be one of device-id, message-id, none, is: %s", config.Key)
+	}
+
+	acks, err := parseRequiredAcks(config.Acks)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := parseCompressionCodec(config.CompressionCodec)
+	if err != nil {
+		return nil, err
+	}
+	balancer, err := parseBalancer(config.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(config.Brokers...),
+		Topic:        config.Topic,
+		Balancer:     balancer,
+		RequiredAcks: acks,
+		BatchSize:    config.BatchSize,
+		BatchTimeout: config.BatchTimeout,
+		Compression:  codec,
+		WriteTimeout: config.WriteTimeout,
+	}
+
+	return &KafkaProducer{
+		Config:         config,
+		Writer:         writer,
+		ResponseWaiter: rw,
+		encoder:        encoder,
+	}, nil
+}
+
+func (p *KafkaProducer) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	var waiterCh chan message.Confirmation
+	if p.Config.ConsumeKafka {
+		waiterCh = p.ResponseWaiter.RegisterMessage(req)
+		defer p.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+	}
+
+	b, err := p.encoder.Marshal(req)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: -1,
+			WireSize:    -1,
+		}
+	}
+
+	msg := p.message(req, b)
+
+	// Blocks until the batch containing msg is acked with the configured acks
+	send := time.Now()
+	if err := p.Writer.WriteMessages(ctx, msg); err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    len(b),
+		}
+	}
+
+	ack := time.Now()
+	// Not confirmed, or the message has nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}
+	}
+
+	conf, err := p.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: len(b),
+		WireSize:    len(b),
+		SendTime:    send,
+		AckTime:     ack,
+	}.WithConfirmation(conf)
+}
+
+// message carries the correlation id in its header and is keyed as configured
+func (p *KafkaProducer) message(req message.Message, value []byte) kafka.Message {
+	msg := kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: CorrelationHeader, Value: []byte(req.CorrelationID())}},
+	}
+	switch p.Config.Key {
+	case "device-id":
+		msg.Key = []byte(req.DeviceInfo.DeviceID)
+	case "message-id":
+		msg.Key = []byte(req.CorrelationID())
+	}
+	return msg
+}
+
+func (p *KafkaProducer) Close() error {
+	return p.Writer.Close()
+}
+
+func parseRequiredAcks(acks string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(acks) {
+	case "none", "0":
+		return kafka.RequireNone, nil
+	case "one", "1":
+		return kafka.RequireOne, nil
+	case "all", "-1":
+		return kafka.RequireAll, nil
+	default:
+		return 0, fmt.Errorf("acks must be one of none, one, all, is: %s", acks)
+	}
+}
+
+func parseCompressionCodec(codec string) (compress.Compression, error) {
+	switch strings.ToLower(codec) {
+	case "none", "":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("compression-codec must be one of none, gzip, snappy, lz4, zstd, is: %s", codec)
+	}
+}
+
+func parseBalancer(partitioner string) (kafka.Balancer, error) {
+	switch strings.ToLower(partitioner) {
+	case "hash":
+		return &kafka.Hash{}, nil
+	case "round-robin":
+		return &kafka.RoundRobin{}, nil
+	case "least-bytes":
+		return &kafka.LeastBytes{}, nil
+	case "crc32":
+		return kafka.CRC32Balancer{}, nil
+	case "murmur2":
+		return kafka.Murmur2Balancer{}, nil
+	default:
+		return nil, fmt.Errorf("partitioner must be one of hash, round-robin, least-bytes, crc32, murmur2, is: %s", partitioner)
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+)
+
+func TestParseRequiredAcks(t *testing.T) {
+	tests := []struct {
+		acks     string
+		expected kafka.RequiredAcks
+		wantErr  bool
+	}{
+		{acks: "none", expected: kafka.RequireNone},
+		{acks: "0", expected: kafka.RequireNone},
+		{acks: "one", expected: kafka.RequireOne},
+		{acks: "1", expected: kafka.RequireOne},
+		{acks: "ALL", expected: kafka.RequireAll},
+		{acks: "-1", expected: kafka.RequireAll},
+		{acks: "two", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		acks, err := parseRequiredAcks(tt.acks)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected err: %v", tt.acks, err)
+		}
+		if !tt.wantErr && acks != tt.expected {
+			t.Fatalf("%s: expected %v, got: %v", tt.acks, tt.expected, acks)
+		}
+	}
+}
+
+func TestParseCompressionCodec(t *testing.T) {
+	tests := []struct {
+		codec    string
+		expected compress.Compression
+		wantErr  bool
+	}{
+		{codec: "", expected: 0},
+		{codec: "none", expected: 0},
+		{codec: "gzip", expected: kafka.Gzip},
+		{codec: "snappy", expected: kafka.Snappy},
+		{codec: "LZ4", expected: kafka.Lz4},
+		{codec: "zstd", expected: kafka.Zstd},
+		{codec: "brotli", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		codec, err := parseCompressionCodec(tt.codec)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected err: %v", tt.codec, err)
+		}
+		if !tt.wantErr && codec != tt.expected {
+			t.Fatalf("%s: expected %v, got: %v", tt.codec, tt.expected, codec)
+		}
+	}
+}
+
+func TestParseBalancer(t *testing.T) {
+	tests := []struct {
+		partitioner string
+		expected    kafka.Balancer
+		wantErr     bool
+	}{
+		{partitioner: "hash", expected: &kafka.Hash{}},
+		{partitioner: "round-robin", expected: &kafka.RoundRobin{}},
+		{partitioner: "least-bytes", expected: &kafka.LeastBytes{}},
+		{partitioner: "crc32", expected: kafka.CRC32Balancer{}},
+		{partitioner: "Murmur2", expected: kafka.Murmur2Balancer{}},
+		{partitioner: "random", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		balancer, err := parseBalancer(tt.partitioner)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected err: %v", tt.partitioner, err)
+		}
+		if !tt.wantErr && fmt.Sprintf("%T", balancer) != fmt.Sprintf("%T", tt.expected) {
+			t.Fatalf("%s: expected %T, got: %T", tt.partitioner, tt.expected, balancer)
+		}
+	}
+}
+
+func TestKafkaProducer_Message(t *testing.T) {
+	req := message.NewProvider(1, 100).GetData()
+
+	tests := []struct {
+		key      string
+		expected string
+		wantErr  bool
+	}{
+		{key: "device-id", expected: req.DeviceInfo.DeviceID},
+		{key: "message-id", expected: req.CorrelationID()},
+		{key: "none", expected: ""},
+		{key: "partition", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p, err := NewKafkaProducer(map[string]interface{}{
+			"brokers": []interface{}{"localhost:9094"},
+			"topic":   "raw",
+			"key":     tt.key,
+		}, waiter.NewResponseWaiter())
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected err: %v", tt.key, err)
+		}
+		if tt.wantErr {
+			continue
+		}
+
+		msg := p.message(req, []byte("{}"))
+		if string(msg.Key) != tt.expected {
+			t.Fatalf("%s: expected key %q, got: %q", tt.key, tt.expected, msg.Key)
+		}
+		if len(msg.Headers) != 1 || msg.Headers[0].Key != CorrelationHeader || string(msg.Headers[0].Value) != req.CorrelationID() {
+			t.Fatalf("%s: expected the correlation header, got: %v", tt.key, msg.Headers)
+		}
+		p.Close()
+	}
+}
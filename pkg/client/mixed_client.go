@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"wplug/pkg/message"
+
+	go_loadgen "github.com/luccadibe/go-loadgen"
+)
+
+// Config:
+// clients:
+//	- type: mqtt
+//	  weight: 70
+//	  config: ...
+//	- type: http
+//	  weight: 30
+//	  config: ...
+//---
+
+// WeightedClient is one entry of a MixedClient, Protocol ends up in every Response it produces.
+type WeightedClient struct {
+	Protocol string
+	Weight   int
+	Client   go_loadgen.Client[message.Message, message.Response]
+}
+
+// MixedClient spreads the devices over several clients by weight. A device always uses the same
+// client, like a real device that speaks a single protocol. Devices are assigned in the order of
+// their first call, so the split matches the weights up to one device also for small pools.
+type MixedClient struct {
+	clients []WeightedClient
+	total   int
+
+	mu      sync.Mutex
+	devices sync.Map // device id to client index, one entry per device seen
+	counts  []int    // devices per client
+}
+
+func NewMixedClient(clients ...WeightedClient) (*MixedClient, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("mixed client needs at least one client")
+	}
+
+	var total int
+	for _, c := range clients {
+		if c.Weight < 1 {
+			return nil, fmt.Errorf("weight of %s must be at least 1, is: %d", c.Protocol, c.Weight)
+		}
+		total += c.Weight
+	}
+
+	return &MixedClient{
+		clients: clients,
+		total:   total,
+		counts:  make([]int, len(clients)),
+	}, nil
+}
+
+func (c *MixedClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	wc := c.pick(req.DeviceInfo.DeviceID)
+
+	resp := wc.Client.CallEndpoint(ctx, req)
+	resp.Protocol = wc.Protocol
+	return resp
+}
+
+// pick returns the client of the device, a new device goes to the client furthest behind its share
+func (c *MixedClient) pick(deviceID string) WeightedClient {
+	if len(c.clients) == 1 {
+		return c.clients[0]
+	}
+	if i, ok := c.devices.Load(deviceID); ok {
+		return c.clients[i.(int)]
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i, ok := c.devices.Load(deviceID); ok {
+		return c.clients[i.(int)]
+	}
+
+	// n devices, share_i = n*weight_i/total; compared times total to stay in integers
+	var n int
+	for _, count := range c.counts {
+		n += count
+	}
+	n++
+	best, behind := 0, 0
+	for i, wc := range c.clients {
+		if d := n*wc.Weight - c.counts[i]*c.total; i == 0 || d > behind {
+			best, behind = i, d
+		}
+	}
+
+	c.counts[best]++
+	c.devices.Store(deviceID, best)
+	return c.clients[best]
+}
+
+func (c *MixedClient) Close() error {
+	var firstErr error
+	for _, wc := range c.clients {
+		if closer, ok := wc.Client.(io.Closer); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"wplug/pkg/message"
+)
+
+func TestMixedClient_SplitsByWeight(t *testing.T) {
+	mqtt, _ := NewNoopClient(nil)
+	http, _ := NewNoopClient(nil)
+
+	c, err := NewMixedClient(
+		WeightedClient{Protocol: "mqtt", Weight: 70, Client: mqtt},
+		WeightedClient{Protocol: "http", Weight: 30, Client: http},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 100)
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		msg := provider.GetData()
+		resp := c.CallEndpoint(context.Background(), msg)
+		counts[resp.Protocol]++
+
+		// A device sticks to its protocol
+		if again := c.CallEndpoint(context.Background(), msg); again.Protocol != resp.Protocol {
+			t.Fatalf("device %s switched from %s to %s", msg.DeviceInfo.DeviceID, resp.Protocol, again.Protocol)
+		}
+	}
+
+	if counts["mqtt"] != 7000 || counts["http"] != 3000 {
+		t.Fatalf("expected 70%% mqtt, got %v", counts)
+	}
+}
+
+func TestMixedClient_SmallPool(t *testing.T) {
+	clients := make([]WeightedClient, 0, 3)
+	for _, weight := range []int{50, 30, 20} {
+		cl, _ := NewNoopClient(nil)
+		clients = append(clients, WeightedClient{Protocol: fmt.Sprintf("w%d", weight), Weight: weight, Client: cl})
+	}
+	c, err := NewMixedClient(clients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 devices calling round-robin, every prefix of the pool stays within one device of its share
+	msg := message.NewProvider(1, 100).GetData()
+	devices := map[string]map[string]bool{}
+	for round := 0; round < 5; round++ {
+		for d := 0; d < 10; d++ {
+			msg.DeviceInfo.DeviceID = fmt.Sprintf("device-%d", d)
+			resp := c.CallEndpoint(context.Background(), msg)
+			if devices[resp.Protocol] == nil {
+				devices[resp.Protocol] = map[string]bool{}
+			}
+			devices[resp.Protocol][msg.DeviceInfo.DeviceID] = true
+
+			if round > 0 {
+				continue
+			}
+			for _, wc := range clients {
+				share := float64((d+1)*wc.Weight) / 100
+				if got := float64(len(devices[wc.Protocol])); got < share-1 || got > share+1 {
+					t.Fatalf("after %d devices %s has %v devices, share %v", d+1, wc.Protocol, got, share)
+				}
+			}
+		}
+	}
+
+	if len(devices["w50"]) != 5 || len(devices["w30"]) != 3 || len(devices["w20"]) != 2 {
+		t.Fatalf("expected a 5/3/2 split, got %v", devices)
+	}
+}
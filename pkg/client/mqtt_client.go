@@ -21,19 +21,25 @@ import (
 //		topic: "topic"
 //		broker: "broker-IP"
 //		qos: 0
+//		encoding: json # optional, see encoding.go
+//		compression: # optional, MQTT 3.1.1 has no header for it, the consumer has to know
+//			algorithm: zstd
 //---
 
 type MQTTConfig struct {
-	Topic  string `yaml:"topic,omitempty"`
-	Broker string `yaml:"broker,omitempty"`
-	QoS    uint64 `yaml:"qos,omitempty"`
+	Topic       string            `yaml:"topic,omitempty"`
+	Broker      string            `yaml:"broker,omitempty"`
+	QoS         uint64            `yaml:"qos,omitempty"`
+	Compression CompressionConfig `yaml:"compression,omitempty"`
 }
 
 type MQTTClient struct {
-	Config   MQTTConfig
-	opts     *paho.ClientOptions
-	rw       *waiter.ResponseWaiter
-	JsonFast jsoniter.API
+	Config     MQTTConfig
+	opts       *paho.ClientOptions
+	rw         *waiter.ResponseWaiter
+	JsonFast   jsoniter.API
+	encoder    Encoder
+	compressor *Compressor
 }
 
 func NewMQTTClientFromParams(topic string, broker string, qos int, rw *waiter.ResponseWaiter) *MQTTClient {
@@ -75,6 +81,25 @@ func NewMQTTClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter)
 		return nil, fmt.Errorf("required fields: topic, broker, qos")
 	}
 
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	compressionMap, err := sectionValue(configMap, "compression")
+	if err != nil {
+		return nil, err
+	}
+	config.Compression, err = ParseCompressionConfig(compressionMap)
+	if err != nil {
+		return nil, fmt.Errorf("parsing compression failed with err: %v", err)
+	}
+
+	compressor, err := NewCompressor(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+
 	jsonFast := jsoniter.ConfigFastest
 
 	opts := paho.NewClientOptions()
@@ -88,10 +113,12 @@ func NewMQTTClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter)
 	log.Printf("mqtt client created and connected!")
 
 	return &MQTTClient{
-		Config:   config,
-		rw:       rw,
-		opts:     opts,
-		JsonFast: jsonFast,
+		Config:     config,
+		rw:         rw,
+		opts:       opts,
+		JsonFast:   jsonFast,
+		encoder:    encoder,
+		compressor: compressor,
 	}, nil
 }
 
@@ -118,19 +145,33 @@ func (c MQTTClient) CallEndpoint(ctx context.Context, req message.Message) messa
 			Err:         err,
 			Latency:     time.Since(start),
 			MessageSize: -1,
+			WireSize:    -1,
 		}
 	}
 	defer client.Disconnect(1)
 
-	waiterCh := c.rw.Register(req.DeviceInfo.DeviceID)
+	waiterCh := c.rw.RegisterMessage(req)
+	defer c.rw.Deregister(req.CorrelationID(), waiterCh)
 
-	b, err := c.JsonFast.Marshal(req)
+	b, err := c.encoder.Marshal(req)
 	if err != nil {
 		return message.Response{
 			Timestamp:   start,
 			Err:         err,
 			Latency:     time.Since(start),
 			MessageSize: -1,
+			WireSize:    -1,
+		}
+	}
+
+	wire, err := c.compressor.Compress(b)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         fmt.Errorf("compressing payload failed with err: %v", err),
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    -1,
 		}
 	}
 
@@ -142,7 +183,7 @@ func (c MQTTClient) CallEndpoint(ctx context.Context, req message.Message) messa
 
 	if client.IsConnectionOpen() {
 
-		token := client.Publish(topic, 1, false, b)
+		token := client.Publish(topic, 1, false, wire)
 		token.Wait()
 
 		if token.Error() != nil {
@@ -152,25 +193,47 @@ func (c MQTTClient) CallEndpoint(ctx context.Context, req message.Message) messa
 				Err:         token.Error(),
 				Latency:     time.Since(start),
 				MessageSize: -1,
+				WireSize:    -1,
 			}
 		}
 	}
+	ack := time.Now()
 	log.Println("publish successful")
 
-	select {
-	case <-waiterCh:
-		latencyNs := time.Now().UnixNano() - send // Could also measure the kafka
+	// Nothing to confirm
+	if waiterCh == nil {
 		return message.Response{
 			Timestamp:   start,
 			Err:         nil,
-			Latency:     time.Duration(latencyNs),
+			Latency:     time.Since(start),
 			MessageSize: len(b),
+			WireSize:    len(wire),
+			SendTime:    time.Unix(0, send),
+			AckTime:     ack,
 		}
-	case <-ctx.Done():
+	}
+
+	conf, err := c.rw.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
 		return message.Response{
-			Timestamp: start,
-			Err:       fmt.Errorf("timeout waiting for kafka"),
-			Latency:   time.Since(start),
-		}
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    len(wire),
+			SendTime:    time.Unix(0, send),
+			AckTime:     ack,
+		}.WithConfirmation(conf)
 	}
+
+	latencyNs := time.Now().UnixNano() - send // Could also measure the kafka
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Duration(latencyNs),
+		MessageSize: len(b),
+		WireSize:    len(wire),
+		SendTime:    time.Unix(0, send),
+		AckTime:     ack,
+	}.WithConfirmation(conf)
 }
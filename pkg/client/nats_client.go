@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Config:
+// client:
+//	type: nats
+//	config:
+//		url: "nats://localhost:4222"
+//		subject: "ingest.{deviceId}" # see template.go
+//		mode: jetstream # core, jetstream (latency until the stream acked)
+//		flush: false # core: wait for a server round trip after publishing
+//		timeout: 10s
+//		credentials-file: "user.creds" # optional
+//		token-env: "NATS_TOKEN" # optional
+//		confirm: false # waits for the configured confirmation source, kafka or nats; consume-kafka is accepted too
+//		encoding: json
+//---
+
+const (
+	NATSModeCore      = "core"
+	NATSModeJetStream = "jetstream"
+)
+
+type NATSConfig struct {
+	Url             string
+	Subject         string
+	Mode            string
+	Flush           bool
+	Timeout         time.Duration
+	CredentialsFile string
+	TokenEnv        string
+	Confirm         bool
+	TLS             TLSConfig
+}
+
+type NATSClient struct {
+	Config         NATSConfig
+	ResponseWaiter *waiter.ResponseWaiter
+	encoder        Encoder
+
+	mu sync.Mutex
+	nc *nats.Conn
+	js jetstream.JetStream
+}
+
+func NewNATSClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter) (*NATSClient, error) {
+	var config NATSConfig
+	var err error
+
+	if config.Url, err = stringValue(configMap, "url", nats.DefaultURL); err != nil {
+		return nil, err
+	}
+	if config.Subject, err = stringValue(configMap, "subject", ""); err != nil {
+		return nil, err
+	}
+	if config.Subject == "" {
+		return nil, fmt.Errorf("config-map must include subject")
+	}
+
+	mode, err := stringValue(configMap, "mode", NATSModeCore)
+	if err != nil {
+		return nil, err
+	}
+	config.Mode = strings.ToLower(mode)
+	if config.Mode != NATSModeCore && config.Mode != NATSModeJetStream {
+		return nil, fmt.Errorf("mode must be one of core, jetstream, is: %s", mode)
+	}
+
+	if config.Flush, err = boolValue(configMap, "flush", false); err != nil {
+		return nil, err
+	}
+	if config.Timeout, err = durationValue(configMap, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.CredentialsFile, err = stringValue(configMap, "credentials-file", ""); err != nil {
+		return nil, err
+	}
+	if config.TokenEnv, err = stringValue(configMap, "token-env", ""); err != nil {
+		return nil, err
+	}
+	if config.Confirm, err = confirmValue(configMap, true); err != nil {
+		return nil, err
+	}
+
+	tlsMap, err := sectionValue(configMap, "tls")
+	if err != nil {
+		return nil, err
+	}
+	if config.TLS, err = ParseTLSConfig(tlsMap); err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSClient{
+		Config:         config,
+		ResponseWaiter: rw,
+		encoder:        encoder,
+	}, nil
+}
+
+func (c *NATSClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	var waiterCh chan message.Confirmation
+	if c.Config.Confirm {
+		waiterCh = c.ResponseWaiter.RegisterMessage(req)
+		defer c.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+	}
+
+	b, err := c.encoder.Marshal(req)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: -1,
+			WireSize:    -1,
+		}
+	}
+
+	nc, js, err := c.connection()
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    -1,
+		}
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.Config.Timeout)
+	defer cancel()
+
+	msg := nats.NewMsg(renderTemplate(c.Config.Subject, req))
+	msg.Header.Set("Content-Type", c.encoder.ContentType())
+	msg.Header.Set(CorrelationHeader, req.CorrelationID())
+	msg.Data = b
+
+	send := time.Now()
+	switch {
+	case js != nil:
+		_, err = js.PublishMsg(callCtx, msg)
+	case c.Config.Flush:
+		if err = nc.PublishMsg(msg); err == nil {
+			err = nc.FlushWithContext(callCtx)
+		}
+	default:
+		err = nc.PublishMsg(msg)
+	}
+
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         fmt.Errorf("publish failed with err: %v", err),
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    len(b),
+		}
+	}
+
+	ack := time.Now()
+	// Not confirmed, or the message has nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: len(b),
+		WireSize:    len(b),
+		SendTime:    send,
+		AckTime:     ack,
+	}.WithConfirmation(conf)
+}
+
+func (c *NATSClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nc != nil {
+		c.nc.Close()
+		c.nc = nil
+		c.js = nil
+	}
+	return nil
+}
+
+// connection connects on first use, nats reconnects on its own afterwards.
+func (c *NATSClient) connection() (*nats.Conn, jetstream.JetStream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.nc != nil {
+		return c.nc, c.js, nil
+	}
+
+	opts, err := natsOptions(c.Config.CredentialsFile, c.Config.TokenEnv, c.Config.TLS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nc, err := nats.Connect(c.Config.Url, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to nats failed with err: %v", err)
+	}
+
+	var js jetstream.JetStream
+	if c.Config.Mode == NATSModeJetStream {
+		if js, err = jetstream.New(nc); err != nil {
+			nc.Close()
+			return nil, nil, fmt.Errorf("creating jetstream context failed with err: %v", err)
+		}
+	}
+
+	c.nc, c.js = nc, js
+	return nc, js, nil
+}
+
+func natsOptions(credentialsFile string, tokenEnv string, tlsConf TLSConfig) ([]nats.Option, error) {
+	opts := []nats.Option{nats.Name("wplug")}
+
+	if credentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(credentialsFile))
+	}
+	if tokenEnv != "" {
+		token := os.Getenv(tokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("nats: env var %s is empty", tokenEnv)
+		}
+		opts = append(opts, nats.Token(token))
+	}
+
+	tlsConfig, err := tlsConf.Build()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"testing"
+	"time"
+	"wplug/pkg/waiter"
+
+	go_yaml "github.com/goccy/go-yaml"
+)
+
+func TestNewNATSClient_Config(t *testing.T) {
+	cl, err := NewNATSClient(map[string]interface{}{
+		"subject": "ingest.{deviceId}",
+		"mode":    "JetStream",
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.Config.Mode != NATSModeJetStream || !cl.Config.Confirm || cl.Config.Timeout != 10*time.Second {
+		t.Fatalf("unexpected config: %+v", cl.Config)
+	}
+
+	invalid := []map[string]interface{}{
+		{"url": "nats://localhost:4222"},
+		{"subject": "ingest", "mode": "stream"},
+	}
+	for _, configMap := range invalid {
+		if _, err := NewNATSClient(configMap, waiter.NewResponseWaiter()); err == nil {
+			t.Fatalf("expected an error for %v", configMap)
+		}
+	}
+}
+
+func TestNewNATSClient_Confirm(t *testing.T) {
+	tests := []struct {
+		configMap map[string]interface{}
+		expected  bool
+	}{
+		{configMap: map[string]interface{}{}, expected: true},
+		{configMap: map[string]interface{}{"confirm": false}, expected: false},
+		{configMap: map[string]interface{}{"consume-kafka": false}, expected: false},
+		{configMap: map[string]interface{}{"confirm": true, "consume-kafka": false}, expected: true},
+	}
+
+	for _, tt := range tests {
+		tt.configMap["subject"] = "ingest"
+		cl, err := NewNATSClient(tt.configMap, waiter.NewResponseWaiter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cl.Config.Confirm != tt.expected {
+			t.Fatalf("%v: expected confirm %v, got: %v", tt.configMap, tt.expected, cl.Config.Confirm)
+		}
+	}
+}
+
+// The nats consumer section and the client config map must agree on tls
+func TestNATS_TLSConfig(t *testing.T) {
+	var consumer NATSConsumerConfig
+	if err := go_yaml.UnmarshalWithOptions([]byte(`
+enabled: true
+subject: "processed.>"
+tls:
+  server-name: "nats.internal"
+`), &consumer, go_yaml.Strict()); err != nil {
+		t.Fatal(err)
+	}
+
+	cl, err := NewNATSClient(map[string]interface{}{
+		"subject": "ingest",
+		"tls":     map[string]interface{}{"server-name": "nats.internal"},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if consumer.TLS != cl.Config.TLS || !consumer.TLS.Enabled {
+		t.Fatalf("expected the same enabled tls config, consumer: %+v, client: %+v", consumer.TLS, cl.Config.TLS)
+	}
+
+	var disabled NATSConsumerConfig
+	if err := go_yaml.Unmarshal([]byte("tls:\n  enabled: false\n  server-name: \"nats.internal\"\n"), &disabled); err != nil {
+		t.Fatal(err)
+	}
+	if disabled.TLS.Enabled {
+		t.Fatal("expected an explicit enabled: false to disable tls")
+	}
+	if err := go_yaml.Unmarshal([]byte("tls:\n  cert-file: \"client.pem\"\n"), &disabled); err == nil {
+		t.Fatal("expected an error for cert-file without key-file")
+	}
+}
+
+func TestNATSOptions_TokenEnv(t *testing.T) {
+	t.Setenv("WPLUG_TEST_NATS_TOKEN", "")
+	if _, err := natsOptions("", "WPLUG_TEST_NATS_TOKEN", TLSConfig{}); err == nil {
+		t.Fatal("expected an error for an empty token env var")
+	}
+
+	t.Setenv("WPLUG_TEST_NATS_TOKEN", "secret")
+	opts, err := natsOptions("", "WPLUG_TEST_NATS_TOKEN", TLSConfig{})
+	if err != nil || len(opts) != 2 {
+		t.Fatalf("expected the name and token options, got %d, err: %v", len(opts), err)
+	}
+}
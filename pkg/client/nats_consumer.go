@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"log"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSConsumerConfig is the top-level `nats:` section, an alternative confirmation source to kafka.
+type NATSConsumerConfig struct {
+	Enabled         bool      `yaml:"enabled"`
+	Url             string    `yaml:"url"`
+	Subject         string    `yaml:"subject"`
+	Queue           string    `yaml:"queue"`
+	CredentialsFile string    `yaml:"credentials-file"`
+	TokenEnv        string    `yaml:"token-env"`
+	TLS             TLSConfig `yaml:"tls"`
+	// see correlation.go
+	Correlation CorrelationConfig `yaml:"correlation"`
+}
+
+type NATSConsumer struct {
+	Config         NATSConsumerConfig
+	ResponseWaiter *waiter.ResponseWaiter
+	jsonFast       jsoniter.API
+}
+
+func NewNATSConsumer(rw *waiter.ResponseWaiter, config NATSConsumerConfig) *NATSConsumer {
+	if config.Url == "" {
+		config.Url = nats.DefaultURL
+	}
+
+	return &NATSConsumer{
+		Config:         config,
+		ResponseWaiter: rw,
+		jsonFast:       jsoniter.ConfigFastest,
+	}
+}
+
+func (nc *NATSConsumer) Start(ctx context.Context) {
+	go func() {
+		opts, err := natsOptions(nc.Config.CredentialsFile, nc.Config.TokenEnv, nc.Config.TLS)
+		if err != nil {
+			log.Printf("nats consumer config invalid: %v", err)
+			return
+		}
+
+		conn, err := nats.Connect(nc.Config.Url, opts...)
+		if err != nil {
+			log.Printf("connecting nats consumer failed with err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		handler := func(m *nats.Msg) {
+			var msg message.Message
+			if err := nc.jsonFast.Unmarshal(m.Data, &msg); err != nil {
+				log.Printf("unmarshalling json failed with err: %v", err)
+				return
+			}
+
+			nc.ResponseWaiter.DeliverKey(nc.Config.Correlation.Key(m.Data, m.Header.Get, msg), msg)
+		}
+
+		var sub *nats.Subscription
+		if nc.Config.Queue != "" {
+			sub, err = conn.QueueSubscribe(nc.Config.Subject, nc.Config.Queue, handler)
+		} else {
+			sub, err = conn.Subscribe(nc.Config.Subject, handler)
+		}
+		if err != nil {
+			log.Printf("nats subscribe failed with err: %v", err)
+			return
+		}
+		defer sub.Unsubscribe()
+
+		<-ctx.Done()
+	}()
+}
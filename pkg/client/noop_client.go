@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+)
+
+// The noop and loopback clients don't talk to a backend. They measure the ceiling of wplug
+// itself: provider, marshalling, collector and (loopback only) the ResponseWaiter.
+//
+// Config:
+// client:
+//	type: loopback # or noop
+//	config:
+//		encoding: json
+//		compression:
+//			algorithm: none
+//		delay: # loopback only, see delay.go
+//			distribution: exponential
+//			mean: 20ms
+//---
+
+// NoopClient serialises the payload and discards it.
+type NoopClient struct {
+	encoder    Encoder
+	compressor *Compressor
+}
+
+func NewNoopClient(configMap map[string]interface{}) (*NoopClient, error) {
+	encoder, compressor, err := serializerFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NoopClient{
+		encoder:    encoder,
+		compressor: compressor,
+	}, nil
+}
+
+func (c NoopClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	b, wire, err := serialize(c.encoder, c.compressor, req)
+	return message.Response{
+		Timestamp:   start,
+		Err:         err,
+		Latency:     time.Since(start),
+		MessageSize: len(b),
+		WireSize:    len(wire),
+	}
+}
+
+// LoopbackClient delivers the message straight into the ResponseWaiter after a synthetic delay.
+type LoopbackClient struct {
+	Delay          DelayDistribution
+	ResponseWaiter *waiter.ResponseWaiter
+	encoder        Encoder
+	compressor     *Compressor
+}
+
+func NewLoopbackClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter) (*LoopbackClient, error) {
+	encoder, compressor, err := serializerFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+
+	delayMap, err := sectionValue(configMap, "delay")
+	if err != nil {
+		return nil, err
+	}
+	delay, err := ParseDelayDistribution(delayMap)
+	if err != nil {
+		return nil, fmt.Errorf("parsing delay failed with err: %v", err)
+	}
+
+	return &LoopbackClient{
+		Delay:          delay,
+		ResponseWaiter: rw,
+		encoder:        encoder,
+		compressor:     compressor,
+	}, nil
+}
+
+func (c LoopbackClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	waiterCh := c.ResponseWaiter.RegisterMessage(req)
+	defer c.ResponseWaiter.Deregister(req.CorrelationID(), waiterCh)
+
+	b, wire, err := serialize(c.encoder, c.compressor, req)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    -1,
+		}
+	}
+
+	send := time.Now()
+	// Nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(wire),
+			SendTime:    send,
+		}
+	}
+	// Like a pipeline that fans the message out into the expected records
+	for i := 0; i < c.ResponseWaiter.Expected(req); i++ {
+		time.AfterFunc(c.Delay.Sample(), func() {
+			c.ResponseWaiter.Deliver(req)
+		})
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, req.CorrelationID(), waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(wire),
+			SendTime:    send,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: len(b),
+		WireSize:    len(wire),
+		SendTime:    send,
+	}.WithConfirmation(conf)
+}
+
+func serializerFromConfig(configMap map[string]interface{}) (Encoder, *Compressor, error) {
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compressionMap, err := sectionValue(configMap, "compression")
+	if err != nil {
+		return nil, nil, err
+	}
+	compression, err := ParseCompressionConfig(compressionMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing compression failed with err: %v", err)
+	}
+	compressor, err := NewCompressor(compression)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encoder, compressor, nil
+}
+
+func serialize(encoder Encoder, compressor *Compressor, req message.Message) ([]byte, []byte, error) {
+	b, err := encoder.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wire, err := compressor.Compress(b)
+	if err != nil {
+		return b, nil, fmt.Errorf("compressing payload failed with err: %v", err)
+	}
+
+	return b, wire, nil
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+)
+
+func TestLoopbackClient_DeliversAfterDelay(t *testing.T) {
+	c, err := NewLoopbackClient(map[string]interface{}{
+		"delay": map[string]interface{}{
+			"distribution": "uniform",
+			"min":          "20ms",
+			"max":          "30ms",
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp := c.CallEndpoint(ctx, message.NewProvider(1, 1000).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Latency < 20*time.Millisecond {
+		t.Fatalf("latency %v is below the configured minimum delay", resp.Latency)
+	}
+	if resp.MessageSize <= 0 || resp.WireSize != resp.MessageSize {
+		t.Fatalf("unexpected sizes: message %d wire %d", resp.MessageSize, resp.WireSize)
+	}
+}
+
+func TestDelayDistribution_Clamps(t *testing.T) {
+	d, err := ParseDelayDistribution(map[string]interface{}{
+		"distribution": "normal",
+		"mean":         "10ms",
+		"stddev":       "50ms",
+		"max":          "15ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if s := d.Sample(); s < 0 || s > 15*time.Millisecond {
+			t.Fatalf("sample %v outside [0, 15ms]", s)
+		}
+	}
+
+	if _, err := ParseDelayDistribution(map[string]interface{}{"distribution": "pareto"}); err == nil {
+		t.Fatal("expected an error for an unknown distribution")
+	}
+}
+
+func TestLoopbackClient_ConcurrentMessagesPerDevice(t *testing.T) {
+	c, err := NewLoopbackClient(map[string]interface{}{
+		"delay": map[string]interface{}{
+			"distribution": "constant",
+			"mean":         "20ms",
+		},
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Same device, different message ids: both confirmations must arrive
+	provider := message.NewProvider(1, 1000)
+	first, second := provider.GetData(), provider.GetData()
+	second.DeviceInfo = first.DeviceInfo
+
+	errs := make(chan error, 2)
+	for _, req := range []message.Message{first, second} {
+		go func(req message.Message) {
+			errs <- c.CallEndpoint(ctx, req).Err
+		}(req)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoopbackClient_ExpectN(t *testing.T) {
+	rw := waiter.NewResponseWaiter()
+	rw.Timeout = time.Second
+	expect, err := waiter.ParseExpect("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Expect = expect
+
+	c, err := NewLoopbackClient(map[string]interface{}{}, rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := c.CallEndpoint(context.Background(), message.NewProvider(1, 1000).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Expected != 3 || resp.Received != 3 || resp.Outcome() != "confirmed" || resp.Phase == "" {
+		t.Fatalf("expected the fan-out columns to be filled: %+v", resp)
+	}
+}
+
+func TestLoopbackClient_NothingToConfirm(t *testing.T) {
+	rw := waiter.NewResponseWaiter()
+	expect, err := waiter.ParseExpect("cumulative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Expect = expect
+
+	c, err := NewLoopbackClient(map[string]interface{}{}, rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without samples the pipeline writes no record, the message is done once sent
+	req := message.NewProvider(1, 1000).GetData()
+	req.Measurements.Cumulative = nil
+	resp := c.CallEndpoint(context.Background(), req)
+	if resp.Err != nil || resp.Outcome() != "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if total := waiter.Total(rw.Accounting()); total.Sent != 0 || total.Lost != 0 {
+		t.Fatalf("unexpected accounting: %v", total)
+	}
+}
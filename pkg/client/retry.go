@@ -0,0 +1,135 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Config:
+// retry:
+//	max-attempts: 5 # 1 = no retries
+//	initial-backoff: 200ms
+//	max-backoff: 30s
+//	multiplier: 2
+//	jitter: 1.0 # 0 = none, 1 = full jitter
+//	retry-on: [429, 500, 502, 503, 504] # default 429 and every 5xx
+//	retry-transport-errors: true
+//	honour-retry-after: true # capped at max-backoff
+//---
+
+type RetryConfig struct {
+	MaxAttempts          int
+	InitialBackoff       time.Duration
+	MaxBackoff           time.Duration
+	Multiplier           float64
+	Jitter               float64
+	RetryOn              map[int]bool // nil = 429 and 5xx
+	RetryTransportErrors bool
+	HonourRetryAfter     bool
+}
+
+func ParseRetryConfig(configMap map[string]interface{}) (RetryConfig, error) {
+	var config RetryConfig
+	var err error
+
+	if config.MaxAttempts, err = intValue(configMap, "max-attempts", 1); err != nil {
+		return config, err
+	}
+	if config.InitialBackoff, err = durationValue(configMap, "initial-backoff", 100*time.Millisecond); err != nil {
+		return config, err
+	}
+	if config.MaxBackoff, err = durationValue(configMap, "max-backoff", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.Multiplier, err = floatValue(configMap, "multiplier", 2); err != nil {
+		return config, err
+	}
+	if config.Jitter, err = floatValue(configMap, "jitter", 1); err != nil {
+		return config, err
+	}
+	if config.RetryTransportErrors, err = boolValue(configMap, "retry-transport-errors", true); err != nil {
+		return config, err
+	}
+	if config.HonourRetryAfter, err = boolValue(configMap, "honour-retry-after", true); err != nil {
+		return config, err
+	}
+
+	codes, err := intSliceValue(configMap, "retry-on", nil)
+	if err != nil {
+		return config, err
+	}
+	if codes != nil {
+		config.RetryOn = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			config.RetryOn[code] = true
+		}
+	}
+
+	if config.MaxAttempts < 1 {
+		return config, fmt.Errorf("max-attempts must be at least 1, is: %d", config.MaxAttempts)
+	}
+	if config.Multiplier < 1 {
+		return config, fmt.Errorf("multiplier must be at least 1, is: %v", config.Multiplier)
+	}
+	if config.Jitter < 0 || config.Jitter > 1 {
+		return config, fmt.Errorf("jitter must be between 0 and 1, is: %v", config.Jitter)
+	}
+
+	return config, nil
+}
+
+// ShouldRetry reports whether a failed attempt is retryable, statusCode is 0 on transport errors.
+func (c RetryConfig) ShouldRetry(statusCode int, err error) bool {
+	if err != nil {
+		return c.RetryTransportErrors
+	}
+	if c.RetryOn == nil {
+		return statusCode == http.StatusTooManyRequests || statusCode >= 500
+	}
+	return c.RetryOn[statusCode]
+}
+
+// Backoff returns the delay before the next attempt, attempt is the number of attempts made so far.
+func (c RetryConfig) Backoff(attempt int, header http.Header) time.Duration {
+	if c.HonourRetryAfter {
+		if wait, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			// A bad header must not stall the VU for longer than our own backoff would
+			return min(wait, c.MaxBackoff)
+		}
+	}
+
+	backoff := float64(c.InitialBackoff) * math.Pow(c.Multiplier, float64(attempt-1))
+	if backoff > float64(c.MaxBackoff) {
+		backoff = float64(c.MaxBackoff)
+	}
+
+	// jitter = 1 spreads the delay over [0, backoff]
+	backoff -= backoff * c.Jitter * rand.Float64()
+
+	return time.Duration(backoff)
+}
+
+// Retry-After is either delay-seconds or an HTTP-date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+	"wplug/pkg/message"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// renderTemplate fills the placeholders of routing keys, subjects etc. with values of msg.
+// Supported: {deviceId}, {platform}, {sourceName}, {authorizationToken}
+func renderTemplate(tmpl string, msg message.Message) string {
+	return renderEscaped(tmpl, msg, nil)
+}
+
+// renderJSONTemplate escapes the values for json strings, e.g. http template bodies.
+func renderJSONTemplate(tmpl string, msg message.Message) string {
+	return renderEscaped(tmpl, msg, jsonEscape)
+}
+
+// renderURLTemplate escapes the values as path segments, a / ? or # of a value stays part of it.
+func renderURLTemplate(tmpl string, msg message.Message) string {
+	return renderEscaped(tmpl, msg, url.PathEscape)
+}
+
+func renderEscaped(tmpl string, msg message.Message, escape func(string) string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+	if escape == nil {
+		escape = func(value string) string { return value }
+	}
+
+	return strings.NewReplacer(
+		"{deviceId}", escape(msg.DeviceInfo.DeviceID),
+		"{platform}", escape(msg.DeviceInfo.Platform),
+		"{sourceName}", escape(msg.SourceName),
+		"{authorizationToken}", escape(msg.DeviceInfo.AuthorizationToken),
+	).Replace(tmpl)
+}
+
+// jsonEscape is the content of the json string of value, without the quotes
+func jsonEscape(value string) string {
+	b, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(value)
+	if err != nil {
+		return value
+	}
+	return string(b[1 : len(b)-1])
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"testing"
+	"wplug/pkg/message"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	msg := message.NewProvider(1, 100).GetData()
+	msg.DeviceInfo.DeviceID = "device-1"
+	msg.DeviceInfo.Platform = "ios"
+
+	if got := renderTemplate("devices.{platform}.{deviceId}", msg); got != "devices.ios.device-1" {
+		t.Fatalf("unexpected routing key: %s", got)
+	}
+	if got := renderTemplate("devices", msg); got != "devices" {
+		t.Fatalf("expected the template without placeholders unchanged, got: %s", got)
+	}
+}
+
+func TestRenderTemplate_Escaping(t *testing.T) {
+	msg := message.NewProvider(1, 100).GetData()
+	msg.DeviceInfo.DeviceID = `a/b?c#d "e" \f`
+
+	var body map[string]string
+	if err := jsoniter.Unmarshal([]byte(renderJSONTemplate(`{"deviceId":"{deviceId}"}`, msg)), &body); err != nil {
+		t.Fatalf("expected a valid json body, got err: %v", err)
+	}
+	if body["deviceId"] != msg.DeviceInfo.DeviceID {
+		t.Fatalf("expected the device id in the body, got: %s", body["deviceId"])
+	}
+
+	if got := renderURLTemplate("https://host/summary/{deviceId}/daily", msg); got != "https://host/summary/a%2Fb%3Fc%23d%20%22e%22%20%5Cf/daily" {
+		t.Fatalf("unexpected url: %s", got)
+	}
+}
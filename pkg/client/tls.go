@@ -0,0 +1,109 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Config:
+// tls:
+//	enabled: true
+//	ca-file: "ca.pem"
+//	cert-file: "client.pem"
+//	key-file: "client-key.pem"
+//	server-name: "ingest.internal"
+//	insecure-skip-verify: false
+//---
+
+// The yaml tags document the top-level sections, e.g. the nats consumer. They are parsed
+// by UnmarshalYAML like the client config maps.
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca-file"`
+	CertFile           string `yaml:"cert-file"`
+	KeyFile            string `yaml:"key-file"`
+	ServerName         string `yaml:"server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"`
+}
+
+func ParseTLSConfig(configMap map[string]interface{}) (TLSConfig, error) {
+	var config TLSConfig
+	var err error
+
+	// Setting any of the fields implies tls, so enabled is optional
+	if config.Enabled, err = boolValue(configMap, "enabled", len(configMap) > 0); err != nil {
+		return config, err
+	}
+	if config.CAFile, err = stringValue(configMap, "ca-file", ""); err != nil {
+		return config, err
+	}
+	if config.CertFile, err = stringValue(configMap, "cert-file", ""); err != nil {
+		return config, err
+	}
+	if config.KeyFile, err = stringValue(configMap, "key-file", ""); err != nil {
+		return config, err
+	}
+	if config.ServerName, err = stringValue(configMap, "server-name", ""); err != nil {
+		return config, err
+	}
+	if config.InsecureSkipVerify, err = boolValue(configMap, "insecure-skip-verify", false); err != nil {
+		return config, err
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return config, fmt.Errorf("tls: cert-file and key-file must be set together")
+	}
+
+	return config, nil
+}
+
+// UnmarshalYAML keeps one parse path for the top-level sections and the client config maps.
+func (c *TLSConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var configMap map[string]interface{}
+	if err := unmarshal(&configMap); err != nil {
+		return err
+	}
+
+	config, err := ParseTLSConfig(configMap)
+	if err != nil {
+		return err
+	}
+	*c = config
+	return nil
+}
+
+// Build returns nil if tls is disabled.
+func (c TLSConfig) Build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca-file failed with err: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca-file %s contains no certificates", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate failed with err: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,422 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/gorilla/websocket"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Config:
+// client:
+//	type: websocket
+//	config:
+//		url: "wss://host/stream"
+//		timeout: 10s # write and ack timeout per frame
+//		ack: true # wait for an ack frame like {"id": "<message id>"}
+//		ack-id-field: "id"
+//		pool-size: 0 # 0 = one socket per device, otherwise devices share N sockets
+//		consume-kafka: false
+//		encoding: json
+//		headers:
+//			Authorization: "Bearer token"
+//		tls:
+//			insecure-skip-verify: true
+//---
+
+type WebSocketConfig struct {
+	Url          string
+	Timeout      time.Duration
+	Ack          bool
+	AckIDField   string
+	PoolSize     int
+	ConsumeKafka bool
+	Headers      http.Header
+	TLS          TLSConfig
+}
+
+type WebSocketClient struct {
+	Config         WebSocketConfig
+	Dialer         *websocket.Dialer
+	ResponseWaiter *waiter.ResponseWaiter
+	encoder        Encoder
+	frameType      int
+	jsonFast       jsoniter.API
+
+	// mu only guards the maps, dials run outside of it
+	mu      sync.Mutex
+	sockets map[string]*wsSocket
+	dials   map[string]*wsDial
+}
+
+// wsDial is a dial in progress, calls for the same key wait for it instead of dialing again.
+type wsDial struct {
+	done   chan struct{}
+	socket *wsSocket
+	err    error
+}
+
+// wsSocket is one open connection, gorilla allows a single concurrent writer and reader.
+type wsSocket struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+	closed  chan struct{}
+	err     error
+}
+
+func NewWebSocketClient(configMap map[string]interface{}, rw *waiter.ResponseWaiter) (*WebSocketClient, error) {
+	var config WebSocketConfig
+	var err error
+
+	if config.Url, err = stringValue(configMap, "url", ""); err != nil {
+		return nil, err
+	}
+	if config.Url == "" {
+		return nil, fmt.Errorf("config-map must include url")
+	}
+	if config.Timeout, err = durationValue(configMap, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.Ack, err = boolValue(configMap, "ack", false); err != nil {
+		return nil, err
+	}
+	if config.AckIDField, err = stringValue(configMap, "ack-id-field", "id"); err != nil {
+		return nil, err
+	}
+	if config.PoolSize, err = intValue(configMap, "pool-size", 0); err != nil {
+		return nil, err
+	}
+	if config.ConsumeKafka, err = boolValue(configMap, "consume-kafka", true); err != nil {
+		return nil, err
+	}
+
+	if config.Headers, err = headerValue(configMap, "headers"); err != nil {
+		return nil, err
+	}
+
+	tlsMap, err := sectionValue(configMap, "tls")
+	if err != nil {
+		return nil, err
+	}
+	if config.TLS, err = ParseTLSConfig(tlsMap); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoderFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
+	frameType := websocket.BinaryMessage
+	if _, ok := encoder.(JSONEncoder); ok {
+		frameType = websocket.TextMessage
+	}
+
+	return &WebSocketClient{
+		Config: config,
+		Dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: config.Timeout,
+			TLSClientConfig:  tlsConfig,
+		},
+		ResponseWaiter: rw,
+		encoder:        encoder,
+		frameType:      frameType,
+		jsonFast:       jsoniter.ConfigFastest,
+		sockets:        make(map[string]*wsSocket),
+		dials:          make(map[string]*wsDial),
+	}, nil
+}
+
+func (c *WebSocketClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	start := time.Now()
+
+	id := req.CorrelationID()
+	var waiterCh chan message.Confirmation
+	if c.Config.ConsumeKafka {
+		waiterCh = c.ResponseWaiter.RegisterMessage(req)
+		defer c.ResponseWaiter.Deregister(id, waiterCh)
+	}
+
+	b, err := c.encoder.Marshal(req)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: -1,
+			WireSize:    -1,
+		}
+	}
+
+	key := c.socketKey(req.DeviceInfo.DeviceID)
+	socket, err := c.socket(ctx, key)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    -1,
+		}
+	}
+
+	var ackCh chan struct{}
+	if c.Config.Ack {
+		ackCh = socket.expect(id)
+	}
+
+	send := time.Now()
+
+	socket.writeMu.Lock()
+	socket.conn.SetWriteDeadline(send.Add(c.Config.Timeout))
+	err = socket.conn.WriteMessage(c.frameType, b)
+	socket.writeMu.Unlock()
+	if err != nil {
+		c.drop(key, socket, err)
+		return message.Response{
+			Timestamp:   start,
+			Err:         fmt.Errorf("writing frame failed with err: %v", err),
+			Latency:     time.Since(start),
+			MessageSize: len(b),
+			WireSize:    len(b),
+		}
+	}
+
+	if c.Config.Ack {
+		timer := time.NewTimer(c.Config.Timeout)
+		defer timer.Stop()
+
+		select {
+		case <-ackCh:
+		case <-socket.closed:
+			return message.Response{
+				Timestamp:   start,
+				Err:         fmt.Errorf("socket closed before ack: %v", socket.closeErr()),
+				Latency:     time.Since(send),
+				MessageSize: len(b),
+				WireSize:    len(b),
+			}
+		case <-timer.C:
+			socket.forget(id)
+			return message.Response{
+				Timestamp:   start,
+				Err:         fmt.Errorf("timeout waiting for ack"),
+				Latency:     time.Since(send),
+				MessageSize: len(b),
+				WireSize:    len(b),
+			}
+		case <-ctx.Done():
+			socket.forget(id)
+			return message.Response{
+				Timestamp:   start,
+				Err:         fmt.Errorf("context done"),
+				Latency:     time.Since(send),
+				MessageSize: len(b),
+				WireSize:    len(b),
+			}
+		}
+	}
+
+	ack := time.Now()
+	// Per-frame latency: until the frame is written, or acked if enabled. Also if the message has
+	// nothing to confirm
+	if waiterCh == nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         nil,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}
+	}
+
+	conf, err := c.ResponseWaiter.Wait(ctx, id, waiterCh)
+	if err != nil {
+		return message.Response{
+			Timestamp:   start,
+			Err:         err,
+			Latency:     time.Since(send),
+			MessageSize: len(b),
+			WireSize:    len(b),
+			SendTime:    send,
+			AckTime:     ack,
+		}.WithConfirmation(conf)
+	}
+
+	return message.Response{
+		Timestamp:   start,
+		Err:         nil,
+		Latency:     time.Since(send),
+		MessageSize: len(b),
+		WireSize:    len(b),
+		SendTime:    send,
+		AckTime:     ack,
+	}.WithConfirmation(conf)
+}
+
+// Close closes all open sockets.
+func (c *WebSocketClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, socket := range c.sockets {
+		socket.writeMu.Lock()
+		socket.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		socket.writeMu.Unlock()
+		socket.conn.Close()
+		delete(c.sockets, key)
+	}
+	return nil
+}
+
+func (c *WebSocketClient) socketKey(deviceID string) string {
+	if c.Config.PoolSize <= 0 {
+		return deviceID
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(deviceID))
+	return fmt.Sprintf("%d", h.Sum32()%uint32(c.Config.PoolSize))
+}
+
+// socket returns the open socket for key and dials a new one if there is none. Only one dial
+// per key runs at a time, a slow endpoint doesn't hold up the other devices.
+func (c *WebSocketClient) socket(ctx context.Context, key string) (*wsSocket, error) {
+	c.mu.Lock()
+	if socket, ok := c.sockets[key]; ok {
+		c.mu.Unlock()
+		return socket, nil
+	}
+	if dial, ok := c.dials[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-dial.done:
+			return dial.socket, dial.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("context done")
+		}
+	}
+	dial := &wsDial{done: make(chan struct{})}
+	c.dials[key] = dial
+	c.mu.Unlock()
+
+	conn, _, err := c.Dialer.DialContext(ctx, c.Config.Url, c.Config.Headers)
+	if err != nil {
+		dial.err = fmt.Errorf("dialing websocket failed with err: %v", err)
+	} else {
+		dial.socket = &wsSocket{
+			conn:    conn,
+			pending: make(map[string]chan struct{}),
+			closed:  make(chan struct{}),
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.dials, key)
+	if dial.socket != nil {
+		c.sockets[key] = dial.socket
+	}
+	c.mu.Unlock()
+	close(dial.done)
+
+	if dial.socket != nil {
+		go c.readAcks(key, dial.socket)
+	}
+	return dial.socket, dial.err
+}
+
+func (c *WebSocketClient) drop(key string, socket *wsSocket, err error) {
+	c.mu.Lock()
+	if c.sockets[key] == socket {
+		delete(c.sockets, key)
+	}
+	c.mu.Unlock()
+
+	socket.close(err)
+}
+
+// readAcks must always run, gorilla only processes control frames (ping, close) while reading.
+func (c *WebSocketClient) readAcks(key string, socket *wsSocket) {
+	for {
+		_, data, err := socket.conn.ReadMessage()
+		if err != nil {
+			c.drop(key, socket, err)
+			return
+		}
+
+		if !c.Config.Ack {
+			continue
+		}
+
+		var ack map[string]interface{}
+		if err := c.jsonFast.Unmarshal(data, &ack); err != nil {
+			continue
+		}
+		if id, ok := ack[c.Config.AckIDField].(string); ok {
+			socket.acknowledge(id)
+		}
+	}
+}
+
+func (s *wsSocket) expect(id string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	s.pending[id] = ch
+	return ch
+}
+
+func (s *wsSocket) forget(id string) {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.mu.Unlock()
+}
+
+func (s *wsSocket) acknowledge(id string) {
+	s.mu.Lock()
+	ch, ok := s.pending[id]
+	delete(s.pending, id)
+	s.mu.Unlock()
+
+	if ok {
+		ch <- struct{}{}
+	}
+}
+
+func (s *wsSocket) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	s.err = err
+	close(s.closed)
+	s.conn.Close()
+}
+
+func (s *wsSocket) closeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/gorilla/websocket"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// newAckServer acks every frame with the correlation id of the message and counts the sockets.
+func newAckServer(t *testing.T, sockets *atomic.Int32) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sockets.Add(1)
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg message.Message
+			if err := jsoniter.Unmarshal(data, &msg); err != nil {
+				return
+			}
+			ack, _ := jsoniter.Marshal(map[string]string{"id": msg.CorrelationID()})
+			if err := conn.WriteMessage(websocket.TextMessage, ack); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebSocketClient_Ack(t *testing.T) {
+	var sockets atomic.Int32
+	srv := newAckServer(t, &sockets)
+
+	cl, err := NewWebSocketClient(map[string]interface{}{
+		"url":           "ws" + strings.TrimPrefix(srv.URL, "http"),
+		"ack":           true,
+		"pool-size":     uint64(1),
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	provider := message.NewProvider(1, 100)
+	for i := 0; i < 3; i++ {
+		resp := cl.CallEndpoint(context.Background(), provider.GetData())
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+	}
+
+	if n := sockets.Load(); n != 1 {
+		t.Fatalf("expected frames to share 1 socket, server saw %d", n)
+	}
+}
+
+func TestWebSocketClient_SlowDialDoesNotBlockOtherDevices(t *testing.T) {
+	var sockets atomic.Int32
+	srv := newAckServer(t, &sockets)
+
+	cl, err := NewWebSocketClient(map[string]interface{}{
+		"url":           "ws" + strings.TrimPrefix(srv.URL, "http"),
+		"ack":           true,
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	// The first dial hangs until the test ends
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	var dials atomic.Int32
+	cl.Dialer.NetDialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if dials.Add(1) == 1 {
+			<-release
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	provider := message.NewProvider(1, 100)
+	slow := provider.GetData()
+	slow.DeviceInfo.DeviceID = "slow"
+	go cl.CallEndpoint(context.Background(), slow)
+	for dials.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fast := provider.GetData()
+	fast.DeviceInfo.DeviceID = "fast"
+	done := make(chan message.Response, 1)
+	go func() { done <- cl.CallEndpoint(context.Background(), fast) }()
+
+	select {
+	case resp := <-done:
+		if resp.Err != nil {
+			t.Fatal(resp.Err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the call of another device waited for the slow dial")
+	}
+}
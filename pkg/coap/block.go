@@ -0,0 +1,50 @@
+package coap
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// Block is the value of a Block1 or Block2 option (RFC 7959, section 2.2).
+type Block struct {
+	Num  uint32
+	More bool
+	Size int // 16 to 1024, power of two
+}
+
+func NewBlock(num uint32, more bool, size int) (Block, error) {
+	if size < 16 || size > 1024 || size&(size-1) != 0 {
+		return Block{}, fmt.Errorf("coap: block size must be a power of two between 16 and 1024, is: %d", size)
+	}
+	return Block{Num: num, More: more, Size: size}, nil
+}
+
+func (b Block) szx() uint32 {
+	return uint32(bits.TrailingZeros(uint(b.Size)) - 4)
+}
+
+func (b Block) Encode() []byte {
+	v := b.Num<<4 | b.szx()
+	if b.More {
+		v |= 1 << 3
+	}
+	return EncodeUint(v)
+}
+
+func DecodeBlock(value []byte) (Block, error) {
+	if len(value) > 3 {
+		return Block{}, ErrInvalidMessage
+	}
+
+	v := DecodeUint(value)
+	szx := v & 0x7
+	if szx == 7 {
+		return Block{}, fmt.Errorf("coap: reserved block size exponent")
+	}
+
+	return Block{
+		Num:  v >> 4,
+		More: v&(1<<3) != 0,
+		Size: 1 << (szx + 4),
+	}, nil
+}
@@ -0,0 +1,241 @@
+// Package coap implements the parts of CoAP (RFC 7252) and block-wise transfer (RFC 7959)
+// the coap client needs: encoding and decoding of messages and the Block1/Block2 options.
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type Type uint8
+
+const (
+	Confirmable     Type = 0
+	NonConfirmable  Type = 1
+	Acknowledgement Type = 2
+	Reset           Type = 3
+)
+
+// Code is class.detail packed as class<<5 | detail.
+type Code uint8
+
+const (
+	Empty  Code = 0
+	GET    Code = 1
+	POST   Code = 2
+	PUT    Code = 3
+	DELETE Code = 4
+
+	Created               Code = 2<<5 | 1
+	Deleted               Code = 2<<5 | 2
+	Valid                 Code = 2<<5 | 3
+	Changed               Code = 2<<5 | 4
+	Content               Code = 2<<5 | 5
+	Continue              Code = 2<<5 | 31
+	BadRequest            Code = 4<<5 | 0
+	RequestEntityTooLarge Code = 4<<5 | 13
+)
+
+func (c Code) Class() uint8 {
+	return uint8(c) >> 5
+}
+
+func (c Code) IsSuccess() bool {
+	return c.Class() == 2
+}
+
+func (c Code) String() string {
+	return fmt.Sprintf("%d.%02d", c.Class(), uint8(c)&0x1f)
+}
+
+type OptionID uint16
+
+const (
+	URIHost       OptionID = 3
+	URIPort       OptionID = 7
+	URIPath       OptionID = 11
+	ContentFormat OptionID = 12
+	URIQuery      OptionID = 15
+	Block2        OptionID = 23
+	Block1        OptionID = 27
+	Size1         OptionID = 60
+)
+
+// Content-Format registry values
+const (
+	FormatOctetStream uint32 = 42
+	FormatJSON        uint32 = 50
+	FormatCBOR        uint32 = 60
+)
+
+type Option struct {
+	ID    OptionID
+	Value []byte
+}
+
+type Message struct {
+	Type      Type
+	Code      Code
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+const payloadMarker = 0xff
+
+var ErrInvalidMessage = errors.New("coap: invalid message")
+
+// Option returns the first option with id.
+func (m Message) Option(id OptionID) ([]byte, bool) {
+	for _, opt := range m.Options {
+		if opt.ID == id {
+			return opt.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Message) AddOption(id OptionID, value []byte) {
+	m.Options = append(m.Options, Option{ID: id, Value: value})
+}
+
+func (m *Message) AddUintOption(id OptionID, value uint32) {
+	m.AddOption(id, EncodeUint(value))
+}
+
+func (m Message) Marshal() ([]byte, error) {
+	if len(m.Token) > 8 {
+		return nil, fmt.Errorf("coap: token longer than 8 bytes")
+	}
+
+	buf := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+16*len(m.Options)+1)
+	buf[0] = 1<<6 | uint8(m.Type)<<4 | uint8(len(m.Token))
+	buf[1] = uint8(m.Code)
+	binary.BigEndian.PutUint16(buf[2:], m.MessageID)
+	buf = append(buf, m.Token...)
+
+	// Options are delta encoded and must be sorted, the order of repeated options is kept
+	opts := append([]Option(nil), m.Options...)
+	sort.SliceStable(opts, func(i, j int) bool { return opts[i].ID < opts[j].ID })
+
+	var prev OptionID
+	for _, opt := range opts {
+		delta, deltaExt := nibble(int(opt.ID - prev))
+		length, lengthExt := nibble(len(opt.Value))
+		buf = append(buf, delta<<4|length)
+		buf = append(buf, deltaExt...)
+		buf = append(buf, lengthExt...)
+		buf = append(buf, opt.Value...)
+		prev = opt.ID
+	}
+
+	if len(m.Payload) > 0 {
+		buf = append(buf, payloadMarker)
+		buf = append(buf, m.Payload...)
+	}
+
+	return buf, nil
+}
+
+func Unmarshal(data []byte) (Message, error) {
+	var m Message
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return m, ErrInvalidMessage
+	}
+
+	m.Type = Type(data[0] >> 4 & 0x3)
+	tkl := int(data[0] & 0xf)
+	m.Code = Code(data[1])
+	m.MessageID = binary.BigEndian.Uint16(data[2:])
+
+	if tkl > 8 || len(data) < 4+tkl {
+		return m, ErrInvalidMessage
+	}
+	m.Token = append([]byte(nil), data[4:4+tkl]...)
+	rest := data[4+tkl:]
+
+	var prev int
+	for len(rest) > 0 {
+		if rest[0] == payloadMarker {
+			if len(rest) == 1 {
+				return m, ErrInvalidMessage
+			}
+			m.Payload = append([]byte(nil), rest[1:]...)
+			break
+		}
+
+		delta, length := int(rest[0]>>4), int(rest[0]&0xf)
+		rest = rest[1:]
+
+		var err error
+		if delta, rest, err = extend(delta, rest); err != nil {
+			return m, err
+		}
+		if length, rest, err = extend(length, rest); err != nil {
+			return m, err
+		}
+		if len(rest) < length {
+			return m, ErrInvalidMessage
+		}
+
+		prev += delta
+		m.Options = append(m.Options, Option{ID: OptionID(prev), Value: append([]byte(nil), rest[:length]...)})
+		rest = rest[length:]
+	}
+
+	return m, nil
+}
+
+func nibble(v int) (uint8, []byte) {
+	switch {
+	case v < 13:
+		return uint8(v), nil
+	case v < 269:
+		return 13, []byte{uint8(v - 13)}
+	default:
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(v-269))
+		return 14, ext
+	}
+}
+
+func extend(v int, rest []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(rest) < 1 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(rest[0]) + 13, rest[1:], nil
+	case 14:
+		if len(rest) < 2 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(binary.BigEndian.Uint16(rest)) + 269, rest[2:], nil
+	case 15:
+		return 0, nil, ErrInvalidMessage
+	default:
+		return v, rest, nil
+	}
+}
+
+// EncodeUint uses the shortest big endian representation, 0 is the empty value.
+func EncodeUint(v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	i := 0
+	for i < 4 && buf[i] == 0 {
+		i++
+	}
+	return buf[i:]
+}
+
+func DecodeUint(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
@@ -0,0 +1,74 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessage_RoundTrip(t *testing.T) {
+	msg := Message{
+		Type:      Confirmable,
+		Code:      POST,
+		MessageID: 0xbeef,
+		Token:     []byte{1, 2, 3, 4},
+		Payload:   []byte(`{"deviceId":"a"}`),
+	}
+	msg.AddOption(URIPath, []byte("import"))
+	msg.AddOption(URIPath, []byte("ingest"))
+	msg.AddUintOption(ContentFormat, FormatJSON)
+	msg.AddOption(Block1, Block{Num: 300, More: true, Size: 512}.Encode())
+	msg.AddUintOption(Size1, 100000) // delta > 13 and > 269 are extended
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Type != msg.Type || got.Code != msg.Code || got.MessageID != msg.MessageID {
+		t.Fatalf("header mismatch: %+v", got)
+	}
+	if !bytes.Equal(got.Token, msg.Token) || !bytes.Equal(got.Payload, msg.Payload) {
+		t.Fatalf("token or payload mismatch: %+v", got)
+	}
+	if len(got.Options) != len(msg.Options) {
+		t.Fatalf("expected %d options, got: %d", len(msg.Options), len(got.Options))
+	}
+
+	value, _ := got.Option(URIPath)
+	if string(value) != "import" {
+		t.Fatalf("expected repeated options to keep their order, got: %s", value)
+	}
+
+	value, _ = got.Option(Block1)
+	block, err := DecodeBlock(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Num != 300 || !block.More || block.Size != 512 {
+		t.Fatalf("unexpected block: %+v", block)
+	}
+
+	value, _ = got.Option(Size1)
+	if DecodeUint(value) != 100000 {
+		t.Fatalf("unexpected size1: %d", DecodeUint(value))
+	}
+}
+
+func TestUnmarshal_Invalid(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x40, 0x02},             // too short
+		{0x00, 0x02, 0x00, 0x01}, // version 0
+		{0x49, 0x02, 0x00, 0x01}, // token length 9
+		{0x40, 0x02, 0x00, 0x01, 0xff},
+	} {
+		if _, err := Unmarshal(data); err == nil {
+			t.Fatalf("expected error for %x", data)
+		}
+	}
+}
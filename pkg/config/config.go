@@ -9,6 +9,7 @@ import (
 	"wplug/pkg/client"
 	"wplug/pkg/load"
 	"wplug/pkg/message"
+	"wplug/pkg/mock"
 	"wplug/pkg/waiter"
 
 	go_yaml "github.com/goccy/go-yaml"
@@ -17,6 +18,7 @@ import (
 
 type ClientConfig struct {
 	Type   string                 `yaml:"type"`
+	Weight int                    `yaml:"weight"` // only used in clients
 	Config map[string]interface{} `yaml:"config"`
 }
 
@@ -26,15 +28,55 @@ type WorkloadConfig struct {
 	MessageSize  int    `yaml:"max-size"`
 }
 
+// ScenarioConfig is used by the scenario preset, see load.Scenario.
+type ScenarioConfig struct {
+	Duration       string       `yaml:"duration"`
+	RampUp         string       `yaml:"ramp-up"`
+	LoopFrom       string       `yaml:"loop-from"`      // step name, defaults to the last step
+	Reauthenticate string       `yaml:"reauthenticate"` // step name, run when a call returns 401
+	Steps          []StepConfig `yaml:"steps"`
+}
+
+type StepConfig struct {
+	Name       string                 `yaml:"name"`
+	Client     ClientConfig           `yaml:"client"`
+	Repeat     int                    `yaml:"repeat"`
+	ThinkTime  map[string]interface{} `yaml:"think-time"` // delay distribution
+	TokenField string                 `yaml:"token-field"`
+	Offline    OfflineConfig          `yaml:"offline"`
+}
+
+type OfflineConfig struct {
+	Probability float64                `yaml:"probability"`
+	Duration    map[string]interface{} `yaml:"duration"` // delay distribution
+}
+
+// WaiterConfig bounds how long the clients wait for confirmations, see waiter.ResponseWaiter.
+type WaiterConfig struct {
+	ConfirmationTimeout string              `yaml:"confirmation-timeout"` // default 30s, 0 waits until the run ends
+	SweepInterval       string              `yaml:"sweep-interval"`       // default 10s
+	Expect              string              `yaml:"expect"`               // records per message, see waiter.ParseExpect
+	Grace               string              `yaml:"grace"`                // default 0, counts extra records of a confirmed message
+	Shards              int                 `yaml:"shards"`               // default 64, more for very high rps
+	Verify              waiter.VerifyConfig `yaml:"verify"`
+}
+
 type CollectorConfig struct {
 	FilePath      string `yaml:"file"`
 	FlushInterval string `yaml:"flush"`
+	// End-of-run accounting of the confirmations per phase, optional
+	AccountingPath string `yaml:"accounting"`
 }
 
 type Config struct {
 	Client    ClientConfig               `yaml:"client"`
+	Clients   []ClientConfig             `yaml:"clients"` // mixed workload, replaces client
 	Kafka     client.KafkaConsumerConfig `yaml:"kafka"`
+	NATS      client.NATSConsumerConfig  `yaml:"nats"`
 	Workload  WorkloadConfig             `yaml:"workload"`
+	Scenario  ScenarioConfig             `yaml:"scenario"`
+	Mock      mock.Config                `yaml:"mock"`
+	Waiter    WaiterConfig               `yaml:"waiter"`
 	Collector CollectorConfig            `yaml:"collector"`
 }
 
@@ -48,54 +90,212 @@ func ParseConfig(data []byte) (*Config, error) {
 	log.Printf("after unmarshal")
 	log.Printf("conf: %v", conf)
 
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
 	return &conf, nil
 }
 
+// validate rejects combinations of sections that parse but can't run together.
+func (c Config) validate() error {
+	// Both consumers would deliver every confirmation, the second one counts as a duplicate
+	if c.Mock.Enabled && c.Mock.ConfirmationsUrl != "" {
+		return fmt.Errorf("mock: enabled and confirmations-url can't be used together")
+	}
+	// The fan-out records differ from the sent message, they would all fail the verification
+	if c.Waiter.Verify.Mode != "" {
+		if expect, err := waiter.ParseExpect(c.Waiter.Expect); err != nil || expect != nil {
+			return fmt.Errorf("waiter: verify can't be used together with expect %q, it needs one record per message", c.Waiter.Expect)
+		}
+	}
+	return nil
+}
+
 func (c Config) StartLoadGeneration(ctx context.Context) error {
-	wl, err := c.GenerateWorkload()
+	rw, sweepInterval, err := c.NewResponseWaiter()
 	if err != nil {
 		return err
 	}
 
-	var kconsumer *client.KafkaConsumer
+	var wl load.Runner
+	if strings.ToLower(c.Workload.Preset) == "scenario" {
+		wl, err = c.GenerateScenario(rw)
+	} else {
+		wl, err = c.GenerateWorkload(rw)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := wl.Close(); err != nil {
+			log.Printf("closing the clients failed with err: %v", err)
+		}
+	}()
+
+	// Entries waiting for twice the timeout were missed by Deregister
+	go rw.Sweep(ctx, sweepInterval, 2*rw.Timeout)
+	defer c.reportAccounting(rw)
+
+	var consumers []client.Consumer
 	if c.Kafka.Enabled {
-		kconsumer, err = c.GenerateKafkaConsumer()
+		kconsumer, err := c.GenerateKafkaConsumer(rw)
 		if err != nil {
 			return err
 		}
+		consumers = append(consumers, kconsumer)
+	}
+	if c.NATS.Enabled {
+		consumers = append(consumers, client.NewNATSConsumer(rw, c.NATS))
+	}
+	if c.Mock.Enabled {
+		srv, err := mock.NewServer(c.Mock)
+		if err != nil {
+			return err
+		}
+		if err := srv.Start(ctx); err != nil {
+			return err
+		}
+		consumers = append(consumers, mock.NewConsumer(srv.Topic, rw))
+	}
+	if c.Mock.ConfirmationsUrl != "" {
+		consumers = append(consumers, mock.NewRemoteConsumer(c.Mock.ConfirmationsUrl, rw))
+	}
+
+	return wl.GenerateWorkload(ctx, consumers...)
+}
+
+// reportAccounting logs the confirmation accounting of the run and writes it to the accounting file.
+func (c Config) reportAccounting(rw *waiter.ResponseWaiter) {
+	log.Printf("response waiter: %v", rw.Stats())
+
+	accounting := rw.Accounting()
+	for _, a := range accounting {
+		log.Printf("confirmations %v", a)
+	}
+	log.Printf("confirmations %v", waiter.Total(accounting))
+
+	if c.Collector.AccountingPath != "" {
+		if err := waiter.WriteAccounting(c.Collector.AccountingPath, accounting); err != nil {
+			log.Printf("writing the accounting failed with err: %v", err)
+		}
+	}
+}
+
+// NewResponseWaiter creates the ResponseWaiter of the waiter section, shared by the clients and
+// consumers of one run, and returns the sweep interval.
+func (c Config) NewResponseWaiter() (*waiter.ResponseWaiter, time.Duration, error) {
+	opts := waiter.Options{Shards: c.Waiter.Shards, Timeout: waiter.DefaultTimeout}
+
+	var err error
+	if c.Waiter.ConfirmationTimeout != "" {
+		if opts.Timeout, err = time.ParseDuration(c.Waiter.ConfirmationTimeout); err != nil {
+			return nil, 0, fmt.Errorf("parsing confirmation-timeout failed with err: %v", err)
+		}
+	}
+	if opts.Expect, err = waiter.ParseExpect(c.Waiter.Expect); err != nil {
+		return nil, 0, err
+	}
+	if c.Waiter.Grace != "" {
+		if opts.Grace, err = time.ParseDuration(c.Waiter.Grace); err != nil {
+			return nil, 0, fmt.Errorf("parsing grace failed with err: %v", err)
+		}
+	}
+	if opts.Verifier, err = waiter.NewVerifier(c.Waiter.Verify); err != nil {
+		return nil, 0, err
+	}
+	rw, err := waiter.New(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sweepInterval := 10 * time.Second
+	if c.Waiter.SweepInterval != "" {
+		if sweepInterval, err = time.ParseDuration(c.Waiter.SweepInterval); err != nil {
+			return nil, 0, fmt.Errorf("parsing sweep-interval failed with err: %v", err)
+		}
+		if sweepInterval <= 0 {
+			return nil, 0, fmt.Errorf("sweep-interval must be positive, is: %v", sweepInterval)
+		}
+	}
+
+	return rw, sweepInterval, nil
+}
+
+// StartMockServer runs the ingestion stand-in of the mock section until ctx is done.
+func (c Config) StartMockServer(ctx context.Context) error {
+	srv, err := mock.NewServer(c.Mock)
+	if err != nil {
+		return err
+	}
+	if err := srv.Start(ctx); err != nil {
+		return err
 	}
 
-	return wl.GenerateWorkload(ctx, kconsumer)
+	srv.Wait()
+	return nil
 }
 
-func (c Config) GenerateClient() (go_loadgen.Client[message.Message, message.Response], error) {
+func (c Config) GenerateClient(rw *waiter.ResponseWaiter) (go_loadgen.Client[message.Message, message.Response], error) {
+	if len(c.Clients) == 0 {
+		cl, err := generateClient(c.Client, rw)
+		if err != nil {
+			return nil, err
+		}
+		return client.NewMixedClient(client.WeightedClient{Protocol: c.Client.Type, Weight: 1, Client: cl})
+	}
+	if c.Client.Type != "" {
+		return nil, fmt.Errorf("client and clients can't be used together")
+	}
 
-	switch c.Client.Type {
+	clients := make([]client.WeightedClient, 0, len(c.Clients))
+	for i, cc := range c.Clients {
+		cl, err := generateClient(cc, rw)
+		if err != nil {
+			return nil, fmt.Errorf("generating client %d (%s) failed with err: %v", i, cc.Type, err)
+		}
+		clients = append(clients, client.WeightedClient{Protocol: cc.Type, Weight: cc.Weight, Client: cl})
+	}
+	return client.NewMixedClient(clients...)
+}
+
+func generateClient(cc ClientConfig, rw *waiter.ResponseWaiter) (go_loadgen.Client[message.Message, message.Response], error) {
+	switch cc.Type {
 	case "http":
-		rw := waiter.GetResponseWaiter()
 		log.Printf("http response waiter: %v", rw)
-		return client.NewHTTPClientFromConfig(c.Client.Config, rw)
+		return client.NewHTTPClientFromConfig(cc.Config, rw)
 	case "mqtt":
-		rw := waiter.GetResponseWaiter()
 		log.Printf("mqtt response waiter: %v", rw)
-		return client.NewMQTTClient(c.Client.Config, rw)
+		return client.NewMQTTClient(cc.Config, rw)
+	case "grpc":
+		log.Printf("grpc response waiter: %v", rw)
+		return client.NewGRPCClient(cc.Config, rw)
+	case "websocket":
+		log.Printf("websocket response waiter: %v", rw)
+		return client.NewWebSocketClient(cc.Config, rw)
+	case "kafka":
+		log.Printf("kafka response waiter: %v", rw)
+		return client.NewKafkaProducer(cc.Config, rw)
+	case "coap":
+		log.Printf("coap response waiter: %v", rw)
+		return client.NewCoAPClient(cc.Config, rw)
+	case "amqp":
+		log.Printf("amqp response waiter: %v", rw)
+		return client.NewAMQPClient(cc.Config, rw)
+	case "nats":
+		log.Printf("nats response waiter: %v", rw)
+		return client.NewNATSClient(cc.Config, rw)
+	case "noop":
+		return client.NewNoopClient(cc.Config)
+	case "loopback":
+		log.Printf("loopback response waiter: %v", rw)
+		return client.NewLoopbackClient(cc.Config, rw)
 	default:
 		return nil, fmt.Errorf("this client type is not supported")
 	}
 }
 
-func (c Config) GenerateKafkaConsumer() (*client.KafkaConsumer, error) {
-	conf := c.Kafka
-
-	kconsumer := client.NewKafkaConsumer(
-		waiter.GetResponseWaiter(),
-		conf.Topic,
-		conf.Partition,
-		conf.MaxBytes,
-		conf.Brokers...,
-	)
-
-	return kconsumer, nil
+func (c Config) GenerateKafkaConsumer(rw *waiter.ResponseWaiter) (*client.KafkaConsumer, error) {
+	return client.NewKafkaConsumer(rw, c.Kafka)
 }
 
 func (c Config) GenerateCollector() (*go_loadgen.CSVCollector[message.Response], error) {
@@ -107,11 +307,28 @@ func (c Config) GenerateCollector() (*go_loadgen.CSVCollector[message.Response],
 	return go_loadgen.NewCSVCollector[message.Response](conf.FilePath, dur)
 }
 
-func (c Config) GenerateWorkload() (*load.Workload, error) {
+// newProvider embeds the content hash if the hash verification is enabled.
+func (c Config) newProvider() (*message.Provider, error) {
+	provider := message.NewProvider(c.Workload.VirtualUsers, c.Workload.MessageSize)
+
+	verifier, err := waiter.NewVerifier(c.Waiter.Verify)
+	if err != nil {
+		return nil, err
+	}
+	if verifier != nil && verifier.Mode == waiter.VerifyHash {
+		provider.ContentHash = verifier.Hash
+	}
+	return provider, nil
+}
+
+func (c Config) GenerateWorkload(rw *waiter.ResponseWaiter) (*load.Workload, error) {
 	log.Printf("before creating anything")
 	conf := c.Workload
 
-	provider := message.NewProvider(conf.VirtualUsers, conf.MessageSize)
+	provider, err := c.newProvider()
+	if err != nil {
+		return nil, err
+	}
 	log.Printf("after creating provider: %v", provider)
 
 	collector, err := c.GenerateCollector()
@@ -120,18 +337,99 @@ func (c Config) GenerateWorkload() (*load.Workload, error) {
 	}
 	log.Printf("after creating collector")
 
-	cl, err := c.GenerateClient()
+	cl, err := c.GenerateClient(rw)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("after generating client")
 
+	var wl *load.Workload
 	switch strings.ToLower(conf.Preset) {
 	case "smoke":
-		return load.NewSmoke(cl, *provider, collector), nil
+		wl = load.NewSmoke(cl, *provider, collector)
 	case "avg":
-		return load.NewAverageLoad(cl, *provider, collector), nil
+		wl = load.NewAverageLoad(cl, *provider, collector)
 	default:
 		return nil, fmt.Errorf("preset not supported")
 	}
+	wl.Waiter = rw
+	return wl, nil
+}
+
+func (c Config) GenerateScenario(rw *waiter.ResponseWaiter) (*load.Scenario, error) {
+	conf := c.Scenario
+	if len(conf.Steps) == 0 {
+		return nil, fmt.Errorf("scenario needs at least one step")
+	}
+
+	provider, err := c.newProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	collector, err := c.GenerateCollector()
+	if err != nil {
+		return nil, fmt.Errorf("generating collector failed with err: %v", err)
+	}
+
+	stepIndex := make(map[string]int, len(conf.Steps))
+	steps := make([]load.ScenarioStep, 0, len(conf.Steps))
+	for i, sc := range conf.Steps {
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("step-%d", i)
+		}
+		stepIndex[sc.Name] = i
+
+		cl, err := generateClient(sc.Client, rw)
+		if err != nil {
+			return nil, fmt.Errorf("generating client of step %s failed with err: %v", sc.Name, err)
+		}
+
+		step := load.ScenarioStep{
+			Name:               sc.Name,
+			Client:             cl,
+			Repeat:             sc.Repeat,
+			TokenField:         sc.TokenField,
+			OfflineProbability: sc.Offline.Probability,
+		}
+		if sc.ThinkTime != nil {
+			thinkTime, err := client.ParseDelayDistribution(sc.ThinkTime)
+			if err != nil {
+				return nil, fmt.Errorf("parsing think-time of step %s failed with err: %v", sc.Name, err)
+			}
+			step.ThinkTime = &thinkTime
+		}
+		if step.Offline, err = client.ParseDelayDistribution(sc.Offline.Duration); err != nil {
+			return nil, fmt.Errorf("parsing offline duration of step %s failed with err: %v", sc.Name, err)
+		}
+		steps = append(steps, step)
+	}
+
+	scenario := load.NewScenario(steps, *provider, collector)
+	scenario.Waiter = rw
+
+	if scenario.Duration, err = time.ParseDuration(conf.Duration); err != nil {
+		return nil, fmt.Errorf("parsing scenario duration failed with err: %v", err)
+	}
+	if conf.RampUp != "" {
+		if scenario.RampUp, err = time.ParseDuration(conf.RampUp); err != nil {
+			return nil, fmt.Errorf("parsing scenario ramp-up failed with err: %v", err)
+		}
+	}
+	if conf.LoopFrom != "" {
+		i, ok := stepIndex[conf.LoopFrom]
+		if !ok {
+			return nil, fmt.Errorf("loop-from step %s does not exist", conf.LoopFrom)
+		}
+		scenario.LoopFrom = i
+	}
+	if conf.Reauthenticate != "" {
+		i, ok := stepIndex[conf.Reauthenticate]
+		if !ok {
+			return nil, fmt.Errorf("reauthenticate step %s does not exist", conf.Reauthenticate)
+		}
+		scenario.Reauth = i
+	}
+
+	return scenario, nil
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"wplug/pkg/waiter"
 )
 
 func TestParseConfig(t *testing.T) {
@@ -22,10 +23,88 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf("unexpected error parsing the config")
 	}
 	log.Printf("conf: %v", conf)
+	// The collector creates its file, keep it out of the tree
+	conf.Collector.FilePath = path.Join(t.TempDir(), "example.csv")
 
-	_, err = conf.GenerateWorkload()
+	_, err = conf.GenerateWorkload(waiter.NewResponseWaiter())
 	if err != nil {
 		t.Fatalf("generating wl failed with err: %v", err)
 	}
 
 }
+
+func TestParseConfig_MixedClients(t *testing.T) {
+	data, err := os.ReadFile(path.Join("test-configs", "client_mixed.yaml"))
+	if err != nil {
+		t.Fatal("mixed: unexpected error reading from file")
+	}
+
+	conf, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the config: %v", err)
+	}
+	if len(conf.Clients) != 2 || conf.Clients[1].Weight != 70 {
+		t.Fatalf("unexpected clients: %v", conf.Clients)
+	}
+
+	if _, err := conf.GenerateClient(waiter.NewResponseWaiter()); err != nil {
+		t.Fatalf("generating mixed client failed with err: %v", err)
+	}
+}
+
+func TestParseConfig_Scenario(t *testing.T) {
+	data, err := os.ReadFile(path.Join("test-configs", "scenario.yaml"))
+	if err != nil {
+		t.Fatal("scenario: unexpected error reading from file")
+	}
+
+	conf, err := ParseConfig(data)
+	if err != nil {
+		t.Fatalf("unexpected error parsing the config: %v", err)
+	}
+	conf.Collector.FilePath = path.Join(t.TempDir(), "example.csv")
+
+	scenario, err := conf.GenerateScenario(waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatalf("generating scenario failed with err: %v", err)
+	}
+	if len(scenario.Steps) != 3 || scenario.LoopFrom != 2 || scenario.Reauth != 1 {
+		t.Fatalf("unexpected scenario: steps %d loop-from %d reauth %d", len(scenario.Steps), scenario.LoopFrom, scenario.Reauth)
+	}
+	if scenario.Steps[2].ThinkTime == nil || scenario.Steps[2].Repeat != 20 {
+		t.Fatalf("upload step not parsed: %+v", scenario.Steps[2])
+	}
+}
+
+func TestParseConfig_MockConsumers(t *testing.T) {
+	data := []byte(`
+mock:
+  enabled: true
+  confirmations-url: "http://localhost:8080/confirmations"
+`)
+	if _, err := ParseConfig(data); err == nil {
+		t.Fatal("expected an error for mock enabled together with confirmations-url")
+	}
+}
+
+func TestParseConfig_VerifyExpect(t *testing.T) {
+	data := []byte(`
+waiter:
+  expect: measurements
+  verify:
+    mode: hash
+`)
+	if _, err := ParseConfig(data); err == nil {
+		t.Fatal("expected an error for verify together with expect")
+	}
+
+	data = []byte(`
+waiter:
+  expect: "1"
+  verify:
+    mode: hash
+`)
+	if _, err := ParseConfig(data); err != nil {
+		t.Fatalf("unexpected error for verify with one record per message: %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package load
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 	"wplug/pkg/client"
 	"wplug/pkg/message"
+	"wplug/pkg/waiter"
 
 	go_loadgen "github.com/luccadibe/go-loadgen"
 )
@@ -15,6 +17,13 @@ type Preset interface {
 	GenerateWorkload() error
 }
 
+// Runner is implemented by the rps based Workload and the device Scenario.
+type Runner interface {
+	GenerateWorkload(ctx context.Context, consumers ...client.Consumer) error
+	// Close releases the clients once the run is over, e.g. flushes producers and closes connections
+	Close() error
+}
+
 type Workload struct {
 	Name      string
 	Duration  time.Duration
@@ -22,6 +31,8 @@ type Workload struct {
 	Client    go_loadgen.Client[message.Message, message.Response]
 	Provider  message.Provider
 	Collector *go_loadgen.CSVCollector[message.Response]
+	// Accounts the confirmations per phase, optional
+	Waiter *waiter.ResponseWaiter
 }
 
 func (s Workload) generateConfig() *go_loadgen.Config {
@@ -32,21 +43,47 @@ func (s Workload) generateConfig() *go_loadgen.Config {
 	}
 }
 
-func (s Workload) GenerateWorkload(ctx context.Context, kafkaConsumer *client.KafkaConsumer) error {
-	startTime := time.Now()
-
-	if kafkaConsumer != nil {
-		go kafkaConsumer.Start(ctx)
+// Schedule are the test phases, the confirmations are accounted in them.
+func (s Workload) Schedule() []waiter.Phase {
+	phases := make([]waiter.Phase, len(s.Phases))
+	for i, p := range s.Phases {
+		phases[i] = waiter.Phase{Name: p.Name, Start: p.StartTime}
 	}
+	return phases
+}
 
+// GenerateWorkload starts the confirmation consumers (kafka, nats) and runs the phases.
+func (s Workload) GenerateWorkload(ctx context.Context, consumers ...client.Consumer) error {
 	runner, err := go_loadgen.NewEndpointWorkload(s.Name, s.generateConfig(), s.Client, s.Provider, s.Collector)
 	if err != nil {
 		return err
 	}
 
+	// The phase boundaries are relative to the start of the runner
+	startTime := time.Now()
+	if s.Waiter != nil {
+		s.Waiter.SetPhases(s.Schedule()...)
+	}
+
+	for _, consumer := range consumers {
+		go consumer.Start(ctx)
+	}
+
 	fmt.Printf("starting runner: %s with config: \nDuration:%v\nMaxSize:%d\nVU:%d", s.Name, s.Duration, s.Provider.MaxSize, s.Provider.DeviceCount)
 	runner.Run()
 	fmt.Printf("finished running in: %v", time.Since(startTime))
 
 	return nil
 }
+
+func (s Workload) Close() error {
+	return closeClient(s.Client)
+}
+
+// closeClient closes the clients that hold connections, the others have nothing to release
+func closeClient(cl go_loadgen.Client[message.Message, message.Response]) error {
+	if closer, ok := cl.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+	"wplug/pkg/client"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	"github.com/google/uuid"
+	go_loadgen "github.com/luccadibe/go-loadgen"
+)
+
+// ScenarioStep is one request type of a device session, e.g. register or upload.
+type ScenarioStep struct {
+	Name   string
+	Client go_loadgen.Client[message.Message, message.Response]
+	Repeat int
+	// Pause after each call, nil for none
+	ThinkTime *client.DelayDistribution
+	// Dot separated path of the token in the json response, it becomes the
+	// authorizationToken of the following messages
+	TokenField string
+	// Chance of the device going offline after a call
+	OfflineProbability float64
+	Offline            client.DelayDistribution
+}
+
+// Scenario runs a scripted lifecycle per virtual device instead of rps phases:
+// every device runs all steps once, then repeats the steps from LoopFrom until Duration is over.
+type Scenario struct {
+	Name     string
+	Duration time.Duration
+	// Devices start evenly spread over RampUp
+	RampUp    time.Duration
+	Devices   int
+	Steps     []ScenarioStep
+	LoopFrom  int
+	Reauth    int // step run when a call returns 401, -1 for none
+	Provider  message.Provider
+	Collector *go_loadgen.CSVCollector[message.Response]
+	// Accounts the confirmations per phase, optional
+	Waiter *waiter.ResponseWaiter
+}
+
+func NewScenario(
+	steps []ScenarioStep,
+	provider message.Provider,
+	collector *go_loadgen.CSVCollector[message.Response],
+) *Scenario {
+
+	return &Scenario{
+		Name:      fmt.Sprintf("Scenario-Test-%d", uuid.New().ID()),
+		Devices:   provider.DeviceCount,
+		Steps:     steps,
+		LoopFrom:  len(steps) - 1,
+		Reauth:    -1,
+		Provider:  provider,
+		Collector: collector,
+	}
+}
+
+// Schedule splits the run into ramp-up and steady, a single phase without ramp-up.
+func (s Scenario) Schedule() []waiter.Phase {
+	if s.RampUp <= 0 {
+		return nil
+	}
+	return []waiter.Phase{
+		{Name: "ramp-up"},
+		{Name: "steady", Start: s.RampUp},
+	}
+}
+
+// GenerateWorkload starts the confirmation consumers (kafka, nats) and runs the device sessions.
+func (s Scenario) GenerateWorkload(ctx context.Context, consumers ...client.Consumer) error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario needs at least one step")
+	}
+	startTime := time.Now()
+	if s.Waiter != nil {
+		s.Waiter.SetPhases(s.Schedule()...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.Duration)
+	defer cancel()
+
+	for _, consumer := range consumers {
+		go consumer.Start(ctx)
+	}
+
+	go s.Collector.RunFlush(ctx)
+	defer s.Collector.Close()
+
+	fmt.Printf("starting scenario: %s with config: \nDuration:%v\nDevices:%d\nSteps:%d", s.Name, s.Duration, s.Devices, len(s.Steps))
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.Devices; i++ {
+		var delay time.Duration
+		if s.Devices > 1 {
+			delay = s.RampUp * time.Duration(i) / time.Duration(s.Devices-1)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sleep(ctx, delay) {
+				s.runDevice(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("finished running in: %v", time.Since(startTime))
+	return nil
+}
+
+// Close closes the clients of all steps.
+func (s Scenario) Close() error {
+	var firstErr error
+	for _, step := range s.Steps {
+		if err := closeClient(step.Client); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// session is the state a device carries from one step to the next
+type session struct {
+	deviceID string
+	token    string
+}
+
+func (s Scenario) runDevice(ctx context.Context) {
+	sess := &session{deviceID: s.Provider.GetData().DeviceInfo.DeviceID}
+
+	for i := 0; ctx.Err() == nil; i++ {
+		step := i
+		if i >= len(s.Steps) {
+			step = s.LoopFrom + (i-len(s.Steps))%(len(s.Steps)-s.LoopFrom)
+		}
+		s.runStep(ctx, sess, s.Steps[step])
+	}
+}
+
+func (s Scenario) runStep(ctx context.Context, sess *session, step ScenarioStep) {
+	for n := 0; n < max(step.Repeat, 1) && ctx.Err() == nil; n++ {
+		resp := s.call(ctx, sess, step)
+
+		if resp.StatusCode == http.StatusUnauthorized && s.Reauth >= 0 && ctx.Err() == nil {
+			s.call(ctx, sess, s.Steps[s.Reauth])
+			s.call(ctx, sess, step)
+		}
+
+		if step.ThinkTime != nil && !sleep(ctx, step.ThinkTime.Sample()) {
+			return
+		}
+		if step.OfflineProbability > 0 && rand.Float64() < step.OfflineProbability {
+			if !sleep(ctx, step.Offline.Sample()) {
+				return
+			}
+		}
+	}
+}
+
+func (s Scenario) call(ctx context.Context, sess *session, step ScenarioStep) message.Response {
+	msg := s.Provider.GetData()
+	msg.DeviceInfo.DeviceID = sess.deviceID
+	if sess.token != "" {
+		msg.DeviceInfo.AuthorizationToken = sess.token
+	}
+	msg = s.Provider.Seal(msg)
+
+	resp := step.Client.CallEndpoint(ctx, msg)
+	resp.Step = step.Name
+
+	if step.TokenField != "" && resp.Err == nil {
+		if token := client.JSONPathValue([]byte(resp.Body), step.TokenField); token != "" {
+			sess.token = token
+		}
+	}
+
+	resp.Body = ""
+	s.Collector.Collect(resp)
+	return resp
+}
+
+// sleep returns false if ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
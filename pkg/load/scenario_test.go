@@ -0,0 +1,121 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wplug/pkg/client"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+
+	go_loadgen "github.com/luccadibe/go-loadgen"
+)
+
+func TestScenario_TokenAndReauthenticate(t *testing.T) {
+	var logins, uploads, rejected atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			n := logins.Add(1)
+			fmt.Fprintf(w, `{"data":{"accessToken":"token-%d"}}`, n)
+		case "/ingest":
+			// The first token expires after the first upload
+			if r.Header.Get("Authorization") == "Bearer token-1" && uploads.Load() > 0 {
+				rejected.Add(1)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Authorization") == "Bearer " {
+				t.Errorf("upload without token")
+			}
+			uploads.Add(1)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	newClient := func(op map[string]interface{}) go_loadgen.Client[message.Message, message.Response] {
+		cl, err := client.NewHTTPClientFromConfig(map[string]interface{}{
+			"consume-kafka": false,
+			"operations":    []interface{}{op},
+		}, waiter.NewResponseWaiter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cl
+	}
+
+	login := ScenarioStep{
+		Name:       "login",
+		Client:     newClient(map[string]interface{}{"url": srv.URL + "/login", "body": "template", "template": `{"deviceId":"{deviceId}"}`}),
+		TokenField: "data.accessToken",
+	}
+	upload := ScenarioStep{
+		Name: "upload",
+		Client: newClient(map[string]interface{}{
+			"url":     srv.URL + "/ingest",
+			"headers": map[string]interface{}{"Authorization": "Bearer {authorizationToken}"},
+		}),
+		Repeat: 3,
+	}
+
+	collector, err := go_loadgen.NewCSVCollector[message.Response](path.Join(t.TempDir(), "scenario.csv"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 100)
+	provider.BaseDeviceInfo.AuthorizationToken = ""
+	scenario := NewScenario([]ScenarioStep{login, upload}, *provider, collector)
+	scenario.Duration = 200 * time.Millisecond
+	scenario.Reauth = 0
+	upload.ThinkTime = &client.DelayDistribution{Distribution: client.DistributionConstant, Mean: 10 * time.Millisecond}
+	scenario.Steps[1] = upload
+
+	if err := scenario.GenerateWorkload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rejected.Load() != 1 {
+		t.Fatalf("expected exactly one rejected upload, got %d", rejected.Load())
+	}
+	if logins.Load() != 2 {
+		t.Fatalf("expected a login and a reauthentication, got %d logins", logins.Load())
+	}
+	if uploads.Load() < 3 {
+		t.Fatalf("expected the upload loop to continue, got %d uploads", uploads.Load())
+	}
+}
+
+// closingClient counts its Close calls
+type closingClient struct {
+	closed *atomic.Int32
+}
+
+func (c closingClient) CallEndpoint(ctx context.Context, req message.Message) message.Response {
+	return message.Response{}
+}
+
+func (c closingClient) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func TestScenario_CloseClosesStepClients(t *testing.T) {
+	var closed atomic.Int32
+	noop, _ := client.NewNoopClient(nil)
+	scenario := NewScenario([]ScenarioStep{
+		{Name: "register", Client: closingClient{closed: &closed}},
+		{Name: "ping", Client: noop},
+		{Name: "upload", Client: closingClient{closed: &closed}},
+	}, *message.NewProvider(1, 1000), nil)
+
+	var runner Runner = scenario
+	if err := runner.Close(); err != nil || closed.Load() != 2 {
+		t.Fatalf("expected both closers to be closed, got %d, err %v", closed.Load(), err)
+	}
+}
@@ -0,0 +1,39 @@
+package message
+
+import "time"
+
+// Confirmation is a processed message read back by a consumer, with the times of the last hops.
+type Confirmation struct {
+	Message     Message
+	AppendTime  time.Time // written into the source, e.g. the kafka message time; zero if unknown
+	ReceiveTime time.Time // read by the consumer
+	// Stages has one entry per configured pipeline stage, nil without stages
+	Stages []StageTime
+	// Fan-out: the records of the last stage, AppendTime and ReceiveTime are the ones of the last record
+	Expected int
+	Received int
+	First    time.Time
+	Last     time.Time
+	// Extra records arrived on top of the expected ones while Wait held the confirmation for Grace
+	Extra int
+	Grace time.Duration
+	// Err is set if the message failed the verification
+	Err error
+	// Phase of the run the message was sent in, set by the waiter
+	Phase string
+}
+
+// StageTime is when a message reached one stage of a multi-stage pipeline, zero if it didn't.
+type StageTime struct {
+	Name        string
+	AppendTime  time.Time
+	ReceiveTime time.Time
+}
+
+// Reached is the append time, or the receive time if the source has no timestamps.
+func (s StageTime) Reached() time.Time {
+	if !s.AppendTime.IsZero() {
+		return s.AppendTime
+	}
+	return s.ReceiveTime
+}
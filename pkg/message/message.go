@@ -7,6 +7,19 @@ type Message struct {
 	SourceName      string       `json:"sourceName,omitempty"`
 	TotalStepsToday *int         `json:"totalStepsToday,omitempty"`
 	Timestamp       string       `json:"timestamp,omitempty"`
+	// Correlates the message with its confirmation, unique per message
+	MessageID string `json:"messageId,omitempty"`
+	// Set by the hash verification, covers everything but the id and the ignored fields
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+// CorrelationID is the key the ResponseWaiter matches confirmations on. Messages
+// without an id fall back to the device, which allows one in-flight message per device.
+func (m Message) CorrelationID() string {
+	if m.MessageID != "" {
+		return m.MessageID
+	}
+	return m.DeviceInfo.DeviceID
 }
 
 type DeviceInfo struct {
@@ -45,3 +58,28 @@ type Cumulative struct {
 }
 
 type Duration struct{}
+
+// Chunks splits the cumulative samples into messages of at most size samples each,
+// every chunk keeps the device and batch info of m.
+func (m Message) Chunks(size int) []Message {
+	cumulative := m.Measurements.Cumulative
+	if size < 1 || len(cumulative) <= size {
+		return []Message{m}
+	}
+
+	chunks := make([]Message, 0, (len(cumulative)+size-1)/size)
+	for start := 0; start < len(cumulative); start += size {
+		end := min(start+size, len(cumulative))
+
+		chunk := m
+		chunk.Measurements.Cumulative = cumulative[start:end]
+		// Send the remaining measurements only once
+		if start > 0 {
+			chunk.Measurements.Instantaneous = []Instantaneous{}
+			chunk.Measurements.Duration = []Duration{}
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
@@ -0,0 +1,4 @@
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative message.proto ingest.proto
+//go:generate protoc --go-grpc_out=. --go-grpc_opt=paths=source_relative ingest.proto
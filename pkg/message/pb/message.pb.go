@@ -0,0 +1,595 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: message.proto
+
+// Protobuf representation of message.Message, field names follow the json tags.
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Message struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	DeviceInfo      *DeviceInfo            `protobuf:"bytes,1,opt,name=device_info,json=deviceInfo,proto3" json:"device_info,omitempty"`
+	BatchInfo       *BatchInfo             `protobuf:"bytes,2,opt,name=batch_info,json=batchInfo,proto3" json:"batch_info,omitempty"`
+	Measurements    *Measurements          `protobuf:"bytes,3,opt,name=measurements,proto3" json:"measurements,omitempty"`
+	SourceName      string                 `protobuf:"bytes,4,opt,name=source_name,json=sourceName,proto3" json:"source_name,omitempty"`
+	TotalStepsToday *int64                 `protobuf:"varint,5,opt,name=total_steps_today,json=totalStepsToday,proto3,oneof" json:"total_steps_today,omitempty"`
+	Timestamp       string                 `protobuf:"bytes,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	MessageId       string                 `protobuf:"bytes,7,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	ContentHash     string                 `protobuf:"bytes,8,opt,name=content_hash,json=contentHash,proto3" json:"content_hash,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_message_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Message) GetDeviceInfo() *DeviceInfo {
+	if x != nil {
+		return x.DeviceInfo
+	}
+	return nil
+}
+
+func (x *Message) GetBatchInfo() *BatchInfo {
+	if x != nil {
+		return x.BatchInfo
+	}
+	return nil
+}
+
+func (x *Message) GetMeasurements() *Measurements {
+	if x != nil {
+		return x.Measurements
+	}
+	return nil
+}
+
+func (x *Message) GetSourceName() string {
+	if x != nil {
+		return x.SourceName
+	}
+	return ""
+}
+
+func (x *Message) GetTotalStepsToday() int64 {
+	if x != nil && x.TotalStepsToday != nil {
+		return *x.TotalStepsToday
+	}
+	return 0
+}
+
+func (x *Message) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+func (x *Message) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *Message) GetContentHash() string {
+	if x != nil {
+		return x.ContentHash
+	}
+	return ""
+}
+
+type DeviceInfo struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Platform           string                 `protobuf:"bytes,1,opt,name=platform,proto3" json:"platform,omitempty"`
+	DeviceId           string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	AuthorizationToken string                 `protobuf:"bytes,3,opt,name=authorization_token,json=authorizationToken,proto3" json:"authorization_token,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *DeviceInfo) Reset() {
+	*x = DeviceInfo{}
+	mi := &file_message_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeviceInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceInfo) ProtoMessage() {}
+
+func (x *DeviceInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceInfo.ProtoReflect.Descriptor instead.
+func (*DeviceInfo) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *DeviceInfo) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *DeviceInfo) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *DeviceInfo) GetAuthorizationToken() string {
+	if x != nil {
+		return x.AuthorizationToken
+	}
+	return ""
+}
+
+type BatchInfo struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	CollectionStart string                 `protobuf:"bytes,1,opt,name=collection_start,json=collectionStart,proto3" json:"collection_start,omitempty"`
+	CollectionEnd   string                 `protobuf:"bytes,2,opt,name=collection_end,json=collectionEnd,proto3" json:"collection_end,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *BatchInfo) Reset() {
+	*x = BatchInfo{}
+	mi := &file_message_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchInfo) ProtoMessage() {}
+
+func (x *BatchInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchInfo.ProtoReflect.Descriptor instead.
+func (*BatchInfo) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchInfo) GetCollectionStart() string {
+	if x != nil {
+		return x.CollectionStart
+	}
+	return ""
+}
+
+func (x *BatchInfo) GetCollectionEnd() string {
+	if x != nil {
+		return x.CollectionEnd
+	}
+	return ""
+}
+
+type Measurements struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Instantaneous []*Instantaneous       `protobuf:"bytes,1,rep,name=instantaneous,proto3" json:"instantaneous,omitempty"`
+	Cumulative    []*Cumulative          `protobuf:"bytes,2,rep,name=cumulative,proto3" json:"cumulative,omitempty"`
+	Duration      []*Duration            `protobuf:"bytes,3,rep,name=duration,proto3" json:"duration,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Measurements) Reset() {
+	*x = Measurements{}
+	mi := &file_message_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Measurements) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Measurements) ProtoMessage() {}
+
+func (x *Measurements) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Measurements.ProtoReflect.Descriptor instead.
+func (*Measurements) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Measurements) GetInstantaneous() []*Instantaneous {
+	if x != nil {
+		return x.Instantaneous
+	}
+	return nil
+}
+
+func (x *Measurements) GetCumulative() []*Cumulative {
+	if x != nil {
+		return x.Cumulative
+	}
+	return nil
+}
+
+func (x *Measurements) GetDuration() []*Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+type Instantaneous struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Value         int64                  `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	Timestamp     string                 `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Instantaneous) Reset() {
+	*x = Instantaneous{}
+	mi := &file_message_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Instantaneous) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Instantaneous) ProtoMessage() {}
+
+func (x *Instantaneous) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Instantaneous.ProtoReflect.Descriptor instead.
+func (*Instantaneous) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Instantaneous) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Instantaneous) GetValue() int64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Instantaneous) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Instantaneous) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+type Cumulative struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Value         int64                  `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	PeriodStart   string                 `protobuf:"bytes,4,opt,name=period_start,json=periodStart,proto3" json:"period_start,omitempty"`
+	PeriodEnd     string                 `protobuf:"bytes,5,opt,name=period_end,json=periodEnd,proto3" json:"period_end,omitempty"`
+	Duration      int64                  `protobuf:"varint,6,opt,name=duration,proto3" json:"duration,omitempty"` // sec
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Cumulative) Reset() {
+	*x = Cumulative{}
+	mi := &file_message_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Cumulative) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Cumulative) ProtoMessage() {}
+
+func (x *Cumulative) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Cumulative.ProtoReflect.Descriptor instead.
+func (*Cumulative) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Cumulative) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Cumulative) GetValue() int64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Cumulative) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Cumulative) GetPeriodStart() string {
+	if x != nil {
+		return x.PeriodStart
+	}
+	return ""
+}
+
+func (x *Cumulative) GetPeriodEnd() string {
+	if x != nil {
+		return x.PeriodEnd
+	}
+	return ""
+}
+
+func (x *Cumulative) GetDuration() int64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+type Duration struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Duration) Reset() {
+	*x = Duration{}
+	mi := &file_message_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Duration) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Duration) ProtoMessage() {}
+
+func (x *Duration) ProtoReflect() protoreflect.Message {
+	mi := &file_message_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Duration.ProtoReflect.Descriptor instead.
+func (*Duration) Descriptor() ([]byte, []int) {
+	return file_message_proto_rawDescGZIP(), []int{6}
+}
+
+var File_message_proto protoreflect.FileDescriptor
+
+const file_message_proto_rawDesc = "" +
+	"\n" +
+	"\rmessage.proto\x12\bwplug.v1\"\xf8\x02\n" +
+	"\aMessage\x125\n" +
+	"\vdevice_info\x18\x01 \x01(\v2\x14.wplug.v1.DeviceInfoR\n" +
+	"deviceInfo\x122\n" +
+	"\n" +
+	"batch_info\x18\x02 \x01(\v2\x13.wplug.v1.BatchInfoR\tbatchInfo\x12:\n" +
+	"\fmeasurements\x18\x03 \x01(\v2\x16.wplug.v1.MeasurementsR\fmeasurements\x12\x1f\n" +
+	"\vsource_name\x18\x04 \x01(\tR\n" +
+	"sourceName\x12/\n" +
+	"\x11total_steps_today\x18\x05 \x01(\x03H\x00R\x0ftotalStepsToday\x88\x01\x01\x12\x1c\n" +
+	"\ttimestamp\x18\x06 \x01(\tR\ttimestamp\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\a \x01(\tR\tmessageId\x12!\n" +
+	"\fcontent_hash\x18\b \x01(\tR\vcontentHashB\x14\n" +
+	"\x12_total_steps_today\"v\n" +
+	"\n" +
+	"DeviceInfo\x12\x1a\n" +
+	"\bplatform\x18\x01 \x01(\tR\bplatform\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x12/\n" +
+	"\x13authorization_token\x18\x03 \x01(\tR\x12authorizationToken\"]\n" +
+	"\tBatchInfo\x12)\n" +
+	"\x10collection_start\x18\x01 \x01(\tR\x0fcollectionStart\x12%\n" +
+	"\x0ecollection_end\x18\x02 \x01(\tR\rcollectionEnd\"\xb3\x01\n" +
+	"\fMeasurements\x12=\n" +
+	"\rinstantaneous\x18\x01 \x03(\v2\x17.wplug.v1.InstantaneousR\rinstantaneous\x124\n" +
+	"\n" +
+	"cumulative\x18\x02 \x03(\v2\x14.wplug.v1.CumulativeR\n" +
+	"cumulative\x12.\n" +
+	"\bduration\x18\x03 \x03(\v2\x12.wplug.v1.DurationR\bduration\"k\n" +
+	"\rInstantaneous\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x1c\n" +
+	"\ttimestamp\x18\x04 \x01(\tR\ttimestamp\"\xa8\x01\n" +
+	"\n" +
+	"Cumulative\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12!\n" +
+	"\fperiod_start\x18\x04 \x01(\tR\vperiodStart\x12\x1d\n" +
+	"\n" +
+	"period_end\x18\x05 \x01(\tR\tperiodEnd\x12\x1a\n" +
+	"\bduration\x18\x06 \x01(\x03R\bduration\"\n" +
+	"\n" +
+	"\bDurationB\x16Z\x14wplug/pkg/message/pbb\x06proto3"
+
+var (
+	file_message_proto_rawDescOnce sync.Once
+	file_message_proto_rawDescData []byte
+)
+
+func file_message_proto_rawDescGZIP() []byte {
+	file_message_proto_rawDescOnce.Do(func() {
+		file_message_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_message_proto_rawDesc), len(file_message_proto_rawDesc)))
+	})
+	return file_message_proto_rawDescData
+}
+
+var file_message_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_message_proto_goTypes = []any{
+	(*Message)(nil),       // 0: wplug.v1.Message
+	(*DeviceInfo)(nil),    // 1: wplug.v1.DeviceInfo
+	(*BatchInfo)(nil),     // 2: wplug.v1.BatchInfo
+	(*Measurements)(nil),  // 3: wplug.v1.Measurements
+	(*Instantaneous)(nil), // 4: wplug.v1.Instantaneous
+	(*Cumulative)(nil),    // 5: wplug.v1.Cumulative
+	(*Duration)(nil),      // 6: wplug.v1.Duration
+}
+var file_message_proto_depIdxs = []int32{
+	1, // 0: wplug.v1.Message.device_info:type_name -> wplug.v1.DeviceInfo
+	2, // 1: wplug.v1.Message.batch_info:type_name -> wplug.v1.BatchInfo
+	3, // 2: wplug.v1.Message.measurements:type_name -> wplug.v1.Measurements
+	4, // 3: wplug.v1.Measurements.instantaneous:type_name -> wplug.v1.Instantaneous
+	5, // 4: wplug.v1.Measurements.cumulative:type_name -> wplug.v1.Cumulative
+	6, // 5: wplug.v1.Measurements.duration:type_name -> wplug.v1.Duration
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_message_proto_init() }
+func file_message_proto_init() {
+	if File_message_proto != nil {
+		return
+	}
+	file_message_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_message_proto_rawDesc), len(file_message_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_message_proto_goTypes,
+		DependencyIndexes: file_message_proto_depIdxs,
+		MessageInfos:      file_message_proto_msgTypes,
+	}.Build()
+	File_message_proto = out.File
+	file_message_proto_goTypes = nil
+	file_message_proto_depIdxs = nil
+}
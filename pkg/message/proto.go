@@ -0,0 +1,105 @@
+package message
+
+import "wplug/pkg/message/pb"
+
+// ToProto converts the message into its protobuf representation (see pb/message.proto).
+func (m Message) ToProto() *pb.Message {
+	measurements := &pb.Measurements{
+		Instantaneous: make([]*pb.Instantaneous, 0, len(m.Measurements.Instantaneous)),
+		Cumulative:    make([]*pb.Cumulative, 0, len(m.Measurements.Cumulative)),
+		Duration:      make([]*pb.Duration, 0, len(m.Measurements.Duration)),
+	}
+	for _, i := range m.Measurements.Instantaneous {
+		measurements.Instantaneous = append(measurements.Instantaneous, &pb.Instantaneous{
+			Type:      i.Type,
+			Value:     int64(i.Value),
+			Unit:      i.Unit,
+			Timestamp: i.Timestamp,
+		})
+	}
+	for _, c := range m.Measurements.Cumulative {
+		measurements.Cumulative = append(measurements.Cumulative, &pb.Cumulative{
+			Type:        c.Type,
+			Value:       int64(c.Value),
+			Unit:        c.Unit,
+			PeriodStart: c.PeriodStart,
+			PeriodEnd:   c.PeriodEnd,
+			Duration:    int64(c.Duration),
+		})
+	}
+	for range m.Measurements.Duration {
+		measurements.Duration = append(measurements.Duration, &pb.Duration{})
+	}
+
+	msg := &pb.Message{
+		DeviceInfo: &pb.DeviceInfo{
+			Platform:           m.DeviceInfo.Platform,
+			DeviceId:           m.DeviceInfo.DeviceID,
+			AuthorizationToken: m.DeviceInfo.AuthorizationToken,
+		},
+		BatchInfo: &pb.BatchInfo{
+			CollectionStart: m.BatchInfo.CollectionStart,
+			CollectionEnd:   m.BatchInfo.CollectionEnd,
+		},
+		Measurements: measurements,
+		SourceName:   m.SourceName,
+		Timestamp:    m.Timestamp,
+		MessageId:    m.MessageID,
+		ContentHash:  m.ContentHash,
+	}
+	if m.TotalStepsToday != nil {
+		steps := int64(*m.TotalStepsToday)
+		msg.TotalStepsToday = &steps
+	}
+
+	return msg
+}
+
+// FromProto is the inverse of ToProto.
+func FromProto(p *pb.Message) Message {
+	measurements := p.GetMeasurements()
+	m := Message{
+		DeviceInfo: DeviceInfo{
+			Platform:           p.GetDeviceInfo().GetPlatform(),
+			DeviceID:           p.GetDeviceInfo().GetDeviceId(),
+			AuthorizationToken: p.GetDeviceInfo().GetAuthorizationToken(),
+		},
+		BatchInfo: BatchInfo{
+			CollectionStart: p.GetBatchInfo().GetCollectionStart(),
+			CollectionEnd:   p.GetBatchInfo().GetCollectionEnd(),
+		},
+		Measurements: Measurements{
+			Instantaneous: make([]Instantaneous, 0, len(measurements.GetInstantaneous())),
+			Cumulative:    make([]Cumulative, 0, len(measurements.GetCumulative())),
+			Duration:      make([]Duration, len(measurements.GetDuration())),
+		},
+		SourceName:  p.GetSourceName(),
+		Timestamp:   p.GetTimestamp(),
+		MessageID:   p.GetMessageId(),
+		ContentHash: p.GetContentHash(),
+	}
+	for _, i := range measurements.GetInstantaneous() {
+		m.Measurements.Instantaneous = append(m.Measurements.Instantaneous, Instantaneous{
+			Type:      i.GetType(),
+			Value:     int(i.GetValue()),
+			Unit:      i.GetUnit(),
+			Timestamp: i.GetTimestamp(),
+		})
+	}
+	for _, c := range measurements.GetCumulative() {
+		m.Measurements.Cumulative = append(m.Measurements.Cumulative, Cumulative{
+			Type:        c.GetType(),
+			Value:       int(c.GetValue()),
+			Unit:        c.GetUnit(),
+			PeriodStart: c.GetPeriodStart(),
+			PeriodEnd:   c.GetPeriodEnd(),
+			Duration:    int(c.GetDuration()),
+		})
+	}
+	if p.TotalStepsToday != nil {
+		steps := int(p.GetTotalStepsToday())
+		m.TotalStepsToday = &steps
+	}
+
+	return m
+}
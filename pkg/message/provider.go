@@ -17,6 +17,8 @@ type Provider struct {
 	BaseCumulative    Cumulative
 	BaseDuration      Duration
 	SourceName        string
+	// ContentHash is set by the hash verification and embedded by Seal
+	ContentHash func(Message) string
 }
 
 func NewProvider(deviceCount int, maxSize int) *Provider {
@@ -56,7 +58,7 @@ func (e Provider) GetData() Message {
 	cumulative := e.GenerateCumulative(collectionStart, collectionEnd, e.MaxSize/3)
 	duration := e.GenerateDuration()
 
-	return Message{
+	return e.Seal(Message{
 		DeviceInfo: e.BaseDeviceInfo,
 		BatchInfo: BatchInfo{
 			fmt.Sprintf("%s", collectionStart.Format(time.RFC3339)),
@@ -69,7 +71,16 @@ func (e Provider) GetData() Message {
 		SourceName:      e.SourceName,
 		TotalStepsToday: nil,
 		Timestamp:       fmt.Sprintf("%s", collectionEnd.Format(time.RFC3339)),
+		MessageID:       uuid.New().String(),
+	})
+}
+
+// Seal embeds the content hash, it must be called again after m was changed.
+func (e Provider) Seal(m Message) Message {
+	if e.ContentHash != nil {
+		m.ContentHash = e.ContentHash(m)
 	}
+	return m
 }
 
 func (e Provider) GenerateInstantaneous() []Instantaneous {
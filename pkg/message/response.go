@@ -2,6 +2,7 @@ package message
 
 import (
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,11 +10,136 @@ type Response struct {
 	Timestamp   time.Time
 	Err         error
 	Latency     time.Duration
-	MessageSize int //in bytes
+	MessageSize int //in bytes, before compression
+	WireSize    int //in bytes, as sent
+	ConnReused  bool
+	// Retries, Latency covers all attempts
+	Attempts           int
+	LastAttemptLatency time.Duration
+	Protocol           string // client type that sent the message
+	Operation          string // http operation, see the client config
+	Step               string // scenario step
+	StatusCode         int    // http only, 0 otherwise
+	Body               string // http response body, not written to the csv
+	// Pipeline stages, zero where the client or the consumer doesn't see the hop.
+	// AppendTime comes from the broker clock, the stages after it are skewed if the clocks are.
+	SendTime    time.Time // handed to the transport
+	AckTime     time.Time // acked by the ingestion endpoint: http response, puback, broker ack, ...
+	AppendTime  time.Time // appended to the confirmation topic
+	ReceiveTime time.Time // read back by the consumer
+	// Multi-stage pipelines, complete if the last stage was reached
+	Stages []StageTime
+	// Fan-out: records the pipeline wrote for the message, Expected is 0 without a consumer
+	Expected      int
+	Received      int
+	Extra         int // records on top of the expected ones, counted during the waiter grace window
+	FirstDelivery time.Time
+	LastDelivery  time.Time
+	// Phase of the run, empty without a consumer
+	Phase string
+}
+
+// WithConfirmation copies what the consumer saw, also the partial progress of a timeout.
+// A failed verification becomes the error of an otherwise successful response. The grace window
+// the waiter held the confirmation for isn't part of the latency.
+func (r Response) WithConfirmation(conf Confirmation) Response {
+	if r.Err == nil {
+		r.Err = conf.Err
+	}
+	r.AppendTime = conf.AppendTime
+	r.ReceiveTime = conf.ReceiveTime
+	r.Stages = conf.Stages
+	r.Expected = conf.Expected
+	r.Received = conf.Received
+	r.Extra = conf.Extra
+	r.Latency -= conf.Grace
+	r.FirstDelivery = conf.First
+	r.LastDelivery = conf.Last
+	r.Phase = conf.Phase
+	return r
+}
+
+// Outcome is "confirmed" or "lost" for a message a consumer waited for, empty otherwise.
+func (r Response) Outcome() string {
+	switch {
+	case r.Phase == "":
+		return ""
+	case r.Expected > 0 && r.Missing() == 0:
+		return "confirmed"
+	default:
+		return "lost"
+	}
+}
+
+// Missing is the number of expected records that didn't arrive.
+func (r Response) Missing() int {
+	return max(r.Expected-r.Received, 0)
+}
+
+// TimeToFirst is send to the first record.
+func (r Response) TimeToFirst() (time.Duration, bool) {
+	return stage(r.SendTime, r.FirstDelivery)
+}
+
+// TimeToLast is send to the last record, the complete fan-out if nothing is missing.
+func (r Response) TimeToLast() (time.Duration, bool) {
+	return stage(r.SendTime, r.LastDelivery)
+}
+
+// IngestLatency is send to ack, the time spent in the ingestion endpoint.
+func (r Response) IngestLatency() (time.Duration, bool) {
+	return stage(r.SendTime, r.AckTime)
+}
+
+// BrokerToKafkaLatency is ack to append, the time the pipeline needs to write the message into kafka.
+func (r Response) BrokerToKafkaLatency() (time.Duration, bool) {
+	return stage(r.AckTime, r.AppendTime)
+}
+
+// ConsumerLag is append to receive.
+func (r Response) ConsumerLag() (time.Duration, bool) {
+	return stage(r.AppendTime, r.ReceiveTime)
+}
+
+// StageLatencies is send to reaching each stage, false for the stages that weren't reached.
+func (r Response) StageLatencies() ([]time.Duration, []bool) {
+	latencies := make([]time.Duration, len(r.Stages))
+	reached := make([]bool, len(r.Stages))
+	for i, s := range r.Stages {
+		latencies[i], reached[i] = stage(r.SendTime, s.Reached())
+	}
+	return latencies, reached
+}
+
+// StagesReached counts the stages the message reached, it may skip one that was missed.
+func (r Response) StagesReached() int {
+	var n int
+	for _, s := range r.Stages {
+		if !s.Reached().IsZero() {
+			n++
+		}
+	}
+	return n
+}
+
+// stage is false if one of the timestamps is missing
+func stage(from time.Time, to time.Time) (time.Duration, bool) {
+	if from.IsZero() || to.IsZero() {
+		return 0, false
+	}
+	return to.Sub(from), true
+}
+
+// stageString is empty for a missing stage
+func stageString(d time.Duration, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return d.String()
 }
 
 func (r Response) CSVHeaders() []string {
-	return []string{"timestamp", "errors", "latency", "message-size"}
+	return []string{"timestamp", "errors", "latency", "message-size", "wire-size", "conn-reused", "attempts", "last-attempt-latency", "protocol", "operation", "step", "status-code", "ingest-latency", "broker-to-kafka-latency", "consumer-lag", "stages-reached", "stage-latencies", "expected", "received", "missing", "extra", "time-to-first", "time-to-last", "phase", "confirmation"}
 }
 
 func (r Response) CSVRecord() []string {
@@ -27,5 +153,58 @@ func (r Response) CSVRecord() []string {
 		errMsg,
 		r.Latency.String(),
 		strconv.Itoa(r.MessageSize),
+		strconv.Itoa(r.WireSize),
+		strconv.FormatBool(r.ConnReused),
+		strconv.Itoa(r.Attempts),
+		r.LastAttemptLatency.String(),
+		r.Protocol,
+		r.Operation,
+		r.Step,
+		strconv.Itoa(r.StatusCode),
+		stageString(r.IngestLatency()),
+		stageString(r.BrokerToKafkaLatency()),
+		stageString(r.ConsumerLag()),
+		stagesReachedString(r),
+		stageLatenciesString(r),
+		countString(r.Expected, r.Expected),
+		countString(r.Expected, r.Received),
+		countString(r.Expected, r.Missing()),
+		countString(r.Expected, r.Extra),
+		stageString(r.TimeToFirst()),
+		stageString(r.TimeToLast()),
+		r.Phase,
+		r.Outcome(),
+	}
+}
+
+// countString is empty if nothing was expected, i.e. no consumer
+func countString(expected int, n int) string {
+	if expected == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// stagesReachedString is e.g. "2/3", empty without stages
+func stagesReachedString(r Response) string {
+	if len(r.Stages) == 0 {
+		return ""
+	}
+	return strconv.Itoa(r.StagesReached()) + "/" + strconv.Itoa(len(r.Stages))
+}
+
+// stageLatenciesString is e.g. "raw=12ms;validated=40ms;aggregated=", the value is empty if a stage wasn't reached
+func stageLatenciesString(r Response) string {
+	latencies, reached := r.StageLatencies()
+
+	var sb strings.Builder
+	for i, s := range r.Stages {
+		if i > 0 {
+			sb.WriteByte(';')
+		}
+		sb.WriteString(s.Name)
+		sb.WriteByte('=')
+		sb.WriteString(stageString(latencies[i], reached[i]))
 	}
+	return sb.String()
 }
@@ -0,0 +1,117 @@
+package mock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"wplug/pkg/waiter"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Consumer feeds the topic of an in-process Server into the ResponseWaiter.
+type Consumer struct {
+	Topic          *Topic
+	ResponseWaiter *waiter.ResponseWaiter
+}
+
+func NewConsumer(topic *Topic, rw *waiter.ResponseWaiter) *Consumer {
+	return &Consumer{
+		Topic:          topic,
+		ResponseWaiter: rw,
+	}
+}
+
+func (c *Consumer) Start(ctx context.Context) {
+	records := c.Topic.Subscribe(ctx, -1)
+	go func() {
+		for record := range records {
+			c.ResponseWaiter.DeliverConfirmation(record.Message.CorrelationID(), record.Confirmation())
+		}
+	}()
+}
+
+// RemoteConsumer reads the confirmations stream of a separate `wplug mock-server`.
+type RemoteConsumer struct {
+	Url            string
+	ResponseWaiter *waiter.ResponseWaiter
+	client         *http.Client
+	jsonFast       jsoniter.API
+}
+
+func NewRemoteConsumer(url string, rw *waiter.ResponseWaiter) *RemoteConsumer {
+	return &RemoteConsumer{
+		Url:            url,
+		ResponseWaiter: rw,
+		client:         &http.Client{},
+		jsonFast:       jsoniter.ConfigFastest,
+	}
+}
+
+func (c *RemoteConsumer) Start(ctx context.Context) {
+	go func() {
+		offset := int64(-1)
+		for ctx.Err() == nil {
+			next, err := c.stream(ctx, offset)
+			if next > offset {
+				offset = next
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("mock confirmations stream ended: %v, reconnecting", err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
+
+// stream delivers records until the connection breaks, it returns the offset to resume from.
+func (c *RemoteConsumer) stream(ctx context.Context, offset int64) (int64, error) {
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return offset, err
+	}
+	if offset >= 0 {
+		q := u.Query()
+		q.Set("offset", strconv.FormatInt(offset, 10))
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return offset, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return offset, fmt.Errorf("recieved statuscode: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), maxBodySize)
+	for scanner.Scan() {
+		var record Record
+		if err := c.jsonFast.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("unmarshalling confirmation failed with err: %v", err)
+			continue
+		}
+
+		c.ResponseWaiter.DeliverConfirmation(record.Message.CorrelationID(), record.Confirmation())
+		offset = record.Offset + 1
+	}
+
+	return offset, scanner.Err()
+}
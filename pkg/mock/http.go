@@ -0,0 +1,97 @@
+package mock
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"wplug/pkg/client"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const maxBodySize = 32 << 20
+
+var strictJSON = client.NewStrictJSONDecoder()
+
+// Handler serves the ingest path, GET /confirmations and GET /healthz.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+s.Config.Path, s.handleIngest)
+	mux.HandleFunc("GET /confirmations", s.handleConfirmations)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		s.rejected.Add(1)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	decoder, err := client.DecoderForContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		s.rejected.Add(1)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	msg, err := s.decode(decoder, b, r.Header.Get("Content-Encoding"))
+	if err != nil {
+		s.rejected.Add(1)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.inject(r.Context()) {
+		http.Error(w, "injected error", s.Config.ErrorStatus)
+		return
+	}
+
+	s.accept(msg)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleConfirmations streams the topic as newline delimited json records,
+// ?offset=N resumes after a reconnect, the default starts at the end.
+func (s *Server) handleConfirmations(w http.ResponseWriter, r *http.Request) {
+	offset := int64(-1)
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		var err error
+		if offset, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			http.Error(w, "offset must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	records := s.Topic.Subscribe(r.Context(), offset)
+	stream := jsoniter.NewStream(jsoniter.ConfigFastest, w, 4096)
+
+	for record := range records {
+		stream.WriteVal(record)
+		stream.WriteRaw("\n")
+
+		// Flush once the backlog is written or the buffer gets large
+		if len(records) == 0 || stream.Buffered() > 64<<10 {
+			if err := stream.Flush(); err != nil {
+				log.Printf("writing confirmations failed with err: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
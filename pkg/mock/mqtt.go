@@ -0,0 +1,265 @@
+package mock
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// A minimal MQTT 3.1.1 broker: it accepts connections and publishes (QoS 0-2) and answers
+// subscribes and pings, but routes nothing to subscribers. Enough for the paho client.
+
+const (
+	mqttConnect     = 1
+	mqttConnack     = 2
+	mqttPublish     = 3
+	mqttPuback      = 4
+	mqttPubrec      = 5
+	mqttPubrel      = 6
+	mqttPubcomp     = 7
+	mqttSubscribe   = 8
+	mqttSuback      = 9
+	mqttUnsubscribe = 10
+	mqttUnsuback    = 11
+	mqttPingreq     = 12
+	mqttPingresp    = 13
+	mqttDisconnect  = 14
+
+	// CONNACK return code for protocol levels other than 3.1 and 3.1.1
+	mqttUnacceptableProtocol = 0x01
+)
+
+type mqttPacket struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+func (s *Server) serveMQTT(ctx context.Context, ln net.Listener) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("mock mqtt accept failed with err: %v", err)
+			}
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			// Unblock the read loop on shutdown
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+
+			if err := s.handleMQTT(ctx, conn); err != nil && !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Printf("mock mqtt connection from %s closed with err: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+func (s *Server) handleMQTT(ctx context.Context, conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	connect, err := readMQTTPacket(r)
+	if err != nil {
+		return err
+	}
+	if connect.Type != mqttConnect {
+		return fmt.Errorf("expected CONNECT, got packet type %d", connect.Type)
+	}
+	keepAlive, err := parseMQTTConnect(connect.Body)
+	if err != nil {
+		conn.Write([]byte{mqttConnack << 4, 2, 0, mqttUnacceptableProtocol})
+		return err
+	}
+	if _, err := conn.Write([]byte{mqttConnack << 4, 2, 0, 0}); err != nil {
+		return err
+	}
+
+	for {
+		// The client has to send something within 1.5 times the keep alive
+		if keepAlive > 0 {
+			conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		}
+
+		p, err := readMQTTPacket(r)
+		if err != nil {
+			return err
+		}
+
+		switch p.Type {
+		case mqttPublish:
+			if err := s.handleMQTTPublish(ctx, conn, p); err != nil {
+				return err
+			}
+		case mqttPubrel:
+			if len(p.Body) < 2 {
+				return fmt.Errorf("malformed PUBREL")
+			}
+			_, err = conn.Write([]byte{mqttPubcomp << 4, 2, p.Body[0], p.Body[1]})
+		case mqttSubscribe:
+			err = writeMQTTSuback(conn, p.Body)
+		case mqttUnsubscribe:
+			if len(p.Body) < 2 {
+				return fmt.Errorf("malformed UNSUBSCRIBE")
+			}
+			_, err = conn.Write([]byte{mqttUnsuback << 4, 2, p.Body[0], p.Body[1]})
+		case mqttPingreq:
+			_, err = conn.Write([]byte{mqttPingresp << 4, 0})
+		case mqttDisconnect:
+			return nil
+		default:
+			return fmt.Errorf("unexpected packet type %d", p.Type)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handleMQTTPublish(ctx context.Context, conn net.Conn, p mqttPacket) error {
+	qos := (p.Flags >> 1) & 0x03
+	if qos > 2 {
+		return fmt.Errorf("invalid QoS %d", qos)
+	}
+
+	topicLen, rest, err := readMQTTUint16(p.Body)
+	if err != nil || len(rest) < int(topicLen) {
+		return fmt.Errorf("malformed PUBLISH")
+	}
+	rest = rest[topicLen:]
+
+	var packetID []byte
+	if qos > 0 {
+		if len(rest) < 2 {
+			return fmt.Errorf("malformed PUBLISH")
+		}
+		packetID, rest = rest[:2], rest[2:]
+	}
+
+	msg, err := s.decode(s.mqttDecoder, rest, s.Config.MQTTCompression)
+	if err != nil {
+		// MQTT 3.1.1 has no way to reject a single message, drop it
+		s.rejected.Add(1)
+		log.Printf("mock mqtt dropped a message: %v", err)
+	} else {
+		if s.inject(ctx) {
+			// Failing is closing the connection without an ack
+			return fmt.Errorf("injected error")
+		}
+		s.accept(msg)
+	}
+
+	switch qos {
+	case 1:
+		_, err = conn.Write([]byte{mqttPuback << 4, 2, packetID[0], packetID[1]})
+	case 2:
+		_, err = conn.Write([]byte{mqttPubrec << 4, 2, packetID[0], packetID[1]})
+	}
+	return err
+}
+
+// parseMQTTConnect checks the protocol level and returns the keep alive.
+func parseMQTTConnect(body []byte) (time.Duration, error) {
+	nameLen, rest, err := readMQTTUint16(body)
+	if err != nil || len(rest) < int(nameLen)+4 {
+		return 0, fmt.Errorf("malformed CONNECT")
+	}
+	rest = rest[nameLen:]
+
+	level := rest[0]
+	if level != 3 && level != 4 {
+		return 0, fmt.Errorf("unsupported protocol level %d", level)
+	}
+
+	keepAlive := binary.BigEndian.Uint16(rest[2:4])
+	return time.Duration(keepAlive) * time.Second, nil
+}
+
+// writeMQTTSuback grants QoS 0 to every requested topic filter.
+func writeMQTTSuback(w io.Writer, body []byte) error {
+	if len(body) < 2 {
+		return fmt.Errorf("malformed SUBSCRIBE")
+	}
+
+	var filters int
+	for rest := body[2:]; len(rest) > 0; filters++ {
+		n, tail, err := readMQTTUint16(rest)
+		if err != nil || len(tail) < int(n)+1 {
+			return fmt.Errorf("malformed SUBSCRIBE")
+		}
+		rest = tail[n+1:]
+	}
+
+	packet := appendMQTTLength([]byte{mqttSuback << 4}, 2+filters)
+	packet = append(packet, body[0], body[1])
+	packet = append(packet, make([]byte, filters)...)
+	_, err := w.Write(packet)
+	return err
+}
+
+func readMQTTPacket(r *bufio.Reader) (mqttPacket, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return mqttPacket{}, err
+	}
+
+	// Remaining length, variable byte integer of at most 4 bytes
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return mqttPacket{}, fmt.Errorf("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return mqttPacket{}, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return mqttPacket{}, err
+	}
+
+	return mqttPacket{Type: header >> 4, Flags: header & 0x0f, Body: body}, nil
+}
+
+func appendMQTTLength(b []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			return b
+		}
+	}
+}
+
+func readMQTTUint16(b []byte) (uint16, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return binary.BigEndian.Uint16(b), b[2:], nil
+}
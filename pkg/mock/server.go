@@ -0,0 +1,218 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"wplug/pkg/client"
+	"wplug/pkg/message"
+)
+
+// Config is the top-level `mock:` section, read by `wplug mock-server` and by the
+// generator if enabled is set.
+//
+// Config:
+// mock:
+//
+//	enabled: false # run the stand-in inside the generator, confirmations skip the network
+//	confirmations-url: "" # or read them from a separate mock-server: http://localhost:8080/confirmations, not with enabled
+//	http-addr: ":8080"
+//	path: "/import/ingest"
+//	mqtt-addr: ":1883" # empty disables the broker stub
+//	mqtt-encoding: json # mqtt has no content type
+//	mqtt-compression: none
+//	skip-validation: false
+//	latency: # delay before answering, see client/delay.go
+//		distribution: lognormal
+//		mean: 20ms
+//		stddev: 10ms
+//	pipeline-latency: # delay until an accepted message shows up on the topic
+//		distribution: exponential
+//		mean: 200ms
+//	error-rate: 0.01 # share of requests that fail
+//	error-status: 503
+//	retention: 100000 # records kept on the topic
+//
+// ---
+type Config struct {
+	Enabled          bool                   `yaml:"enabled"`
+	ConfirmationsUrl string                 `yaml:"confirmations-url"`
+	HTTPAddr         string                 `yaml:"http-addr"`
+	Path             string                 `yaml:"path"`
+	MQTTAddr         string                 `yaml:"mqtt-addr"`
+	MQTTEncoding     string                 `yaml:"mqtt-encoding"`
+	MQTTCompression  string                 `yaml:"mqtt-compression"`
+	SkipValidation   bool                   `yaml:"skip-validation"`
+	Latency          map[string]interface{} `yaml:"latency"`
+	PipelineLatency  map[string]interface{} `yaml:"pipeline-latency"`
+	ErrorRate        float64                `yaml:"error-rate"`
+	ErrorStatus      int                    `yaml:"error-status"`
+	Retention        int                    `yaml:"retention"`
+}
+
+type Server struct {
+	Config Config
+	Topic  *Topic
+
+	latency         client.DelayDistribution
+	pipelineLatency client.DelayDistribution
+	mqttDecoder     client.Decoder
+
+	accepted atomic.Int64
+	rejected atomic.Int64 // failed decoding or validation
+	failed   atomic.Int64 // injected errors
+
+	stopped chan struct{}
+}
+
+func NewServer(config Config) (*Server, error) {
+	if config.HTTPAddr == "" {
+		config.HTTPAddr = ":8080"
+	}
+	if config.Path == "" {
+		config.Path = "/import/ingest"
+	}
+	if config.MQTTEncoding == "" {
+		config.MQTTEncoding = client.EncodingJSON
+	}
+	if config.ErrorStatus == 0 {
+		config.ErrorStatus = http.StatusServiceUnavailable
+	}
+	if config.ErrorRate < 0 || config.ErrorRate > 1 {
+		return nil, fmt.Errorf("error-rate must be between 0 and 1, is: %v", config.ErrorRate)
+	}
+
+	latency, err := client.ParseDelayDistribution(config.Latency)
+	if err != nil {
+		return nil, fmt.Errorf("parsing latency failed with err: %v", err)
+	}
+	pipelineLatency, err := client.ParseDelayDistribution(config.PipelineLatency)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pipeline-latency failed with err: %v", err)
+	}
+	mqttDecoder, err := client.NewDecoder(config.MQTTEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Decompress(nil, config.MQTTCompression); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		Config:          config,
+		Topic:           NewTopic(config.Retention),
+		latency:         latency,
+		pipelineLatency: pipelineLatency,
+		mqttDecoder:     mqttDecoder,
+		stopped:         make(chan struct{}),
+	}, nil
+}
+
+// Start binds the listeners and serves in the background until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	httpLn, err := net.Listen("tcp", s.Config.HTTPAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s failed with err: %v", s.Config.HTTPAddr, err)
+	}
+
+	var mqttLn net.Listener
+	if s.Config.MQTTAddr != "" {
+		if mqttLn, err = net.Listen("tcp", s.Config.MQTTAddr); err != nil {
+			httpLn.Close()
+			return fmt.Errorf("listening on %s failed with err: %v", s.Config.MQTTAddr, err)
+		}
+		go s.serveMQTT(ctx, mqttLn)
+		log.Printf("mock mqtt broker listening on %s", mqttLn.Addr())
+	}
+
+	srv := &http.Server{
+		Handler: s.Handler(),
+		// Ends the confirmation streams on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := srv.Serve(httpLn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("mock http server failed with err: %v", err)
+		}
+	}()
+	log.Printf("mock ingest listening on %s%s", httpLn.Addr(), s.Config.Path)
+
+	go func() {
+		defer close(s.stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		if mqttLn != nil {
+			mqttLn.Close()
+		}
+		log.Printf("mock server stopped: accepted %d, rejected %d, injected errors %d", s.accepted.Load(), s.rejected.Load(), s.failed.Load())
+	}()
+
+	return nil
+}
+
+// Wait blocks until the server shut down after its context ended.
+func (s *Server) Wait() {
+	<-s.stopped
+}
+
+// inject sleeps for the configured latency and reports whether the request should fail.
+func (s *Server) inject(ctx context.Context) bool {
+	if d := s.latency.Sample(); d > 0 {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	if s.Config.ErrorRate > 0 && rand.Float64() < s.Config.ErrorRate {
+		s.failed.Add(1)
+		return true
+	}
+	return false
+}
+
+// accept forwards the message to the topic after the pipeline latency.
+func (s *Server) accept(msg message.Message) {
+	s.accepted.Add(1)
+
+	if d := s.pipelineLatency.Sample(); d > 0 {
+		time.AfterFunc(d, func() {
+			s.Topic.Append(msg)
+		})
+		return
+	}
+	s.Topic.Append(msg)
+}
+
+func (s *Server) decode(decoder client.Decoder, b []byte, contentEncoding string) (message.Message, error) {
+	b, err := client.Decompress(b, contentEncoding)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("decompressing payload failed with err: %v", err)
+	}
+
+	if _, ok := decoder.(client.JSONDecoder); ok && !s.Config.SkipValidation {
+		decoder = strictJSON
+	}
+
+	msg, err := decoder.Unmarshal(b)
+	if err != nil {
+		return msg, fmt.Errorf("decoding payload failed with err: %v", err)
+	}
+
+	if !s.Config.SkipValidation {
+		if err := Validate(msg); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
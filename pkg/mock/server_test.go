@@ -0,0 +1,139 @@
+package mock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wplug/pkg/client"
+	"wplug/pkg/message"
+	"wplug/pkg/waiter"
+)
+
+func newTestServer(t *testing.T, config Config) (*Server, *httptest.Server) {
+	srv, err := NewServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(srv.Handler())
+	t.Cleanup(hs.Close)
+	return srv, hs
+}
+
+func TestServer_HTTPConfirmedThroughTopic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv, hs := newTestServer(t, Config{
+		PipelineLatency: map[string]interface{}{"mean": "10ms"},
+	})
+
+	rw := waiter.NewResponseWaiter()
+	NewConsumer(srv.Topic, rw).Start(ctx)
+
+	cl, err := client.NewHTTPClientFromConfig(map[string]interface{}{
+		"url":         hs.URL + "/import/ingest",
+		"encoding":    "protobuf",
+		"compression": map[string]interface{}{"algorithm": "gzip"},
+	}, rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(ctx, message.NewProvider(1, 1000).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+	if resp.Latency < 10*time.Millisecond {
+		t.Fatalf("latency %v does not include the pipeline latency", resp.Latency)
+	}
+
+	// The pipeline latency lies between the http ack and the append to the topic
+	if d, ok := resp.BrokerToKafkaLatency(); !ok || d < 10*time.Millisecond {
+		t.Fatalf("broker to kafka latency %v (%t) does not include the pipeline latency", d, ok)
+	}
+	if _, ok := resp.IngestLatency(); !ok {
+		t.Fatal("ingest latency missing")
+	}
+	if d, ok := resp.ConsumerLag(); !ok || d < 0 {
+		t.Fatalf("unexpected consumer lag %v (%t)", d, ok)
+	}
+}
+
+func TestServer_RejectsInvalidPayload(t *testing.T) {
+	_, hs := newTestServer(t, Config{})
+
+	body := `{"deviceInfo":{"platform":"iOS","deviceId":""},"batchInfo":{"collectionStart":"2024-01-01T00:00:00Z","collectionEnd":"2024-01-01T00:15:00Z"}}`
+	resp, err := http.Post(hs.URL+"/import/ingest", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a missing device id, got %d", resp.StatusCode)
+	}
+
+	unknown := `{"deviceInfo":{"platform":"iOS","deviceId":"a"},"surprise":1}`
+	resp, err = http.Post(hs.URL+"/import/ingest", "application/json", strings.NewReader(unknown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown field, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_InjectedErrors(t *testing.T) {
+	_, hs := newTestServer(t, Config{ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests})
+
+	cl, err := client.NewHTTPClientFromConfig(map[string]interface{}{
+		"url":           hs.URL + "/import/ingest",
+		"consume-kafka": false,
+	}, waiter.NewResponseWaiter())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(context.Background(), message.NewProvider(1, 100).GetData())
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the injected 429, got %d (%v)", resp.StatusCode, resp.Err)
+	}
+}
+
+func TestServer_MQTTAndRemoteConfirmations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srv, hs := newTestServer(t, Config{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.serveMQTT(ctx, ln)
+	t.Cleanup(func() { ln.Close() })
+
+	rw := waiter.NewResponseWaiter()
+	NewRemoteConsumer(hs.URL+"/confirmations", rw).Start(ctx)
+	// Let the stream connect, it starts at the end of the topic
+	time.Sleep(100 * time.Millisecond)
+
+	cl, err := client.NewMQTTClient(map[string]interface{}{
+		"topic":  "devices/id/data",
+		"broker": "tcp://" + ln.Addr().String(),
+		"qos":    uint64(1),
+	}, rw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := cl.CallEndpoint(ctx, message.NewProvider(1, 1000).GetData())
+	if resp.Err != nil {
+		t.Fatal(resp.Err)
+	}
+}
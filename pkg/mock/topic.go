@@ -0,0 +1,123 @@
+package mock
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wplug/pkg/message"
+)
+
+// Record is one message on the Topic, like a kafka record without key and partition.
+type Record struct {
+	Offset  int64           `json:"offset"`
+	Time    time.Time       `json:"time"`
+	Message message.Message `json:"message"`
+}
+
+// Confirmation is the record as read by a consumer now, Time is the append time.
+func (r Record) Confirmation() message.Confirmation {
+	return message.Confirmation{
+		Message:     r.Message,
+		AppendTime:  r.Time,
+		ReceiveTime: time.Now(),
+	}
+}
+
+// Topic is an in-memory append-only log that stands in for the kafka topic the
+// backend writes processed messages to. Old records are dropped after retention.
+type Topic struct {
+	mu        sync.Mutex
+	records   []Record
+	next      int64
+	retention int
+	// closed and replaced on every append
+	notify chan struct{}
+}
+
+func NewTopic(retention int) *Topic {
+	if retention < 1 {
+		retention = 100000
+	}
+
+	return &Topic{
+		retention: retention,
+		notify:    make(chan struct{}),
+	}
+}
+
+func (t *Topic) Append(msg message.Message) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offset := t.next
+	t.records = append(t.records, Record{Offset: offset, Time: time.Now(), Message: msg})
+	t.next++
+
+	// Trim in bulk so appends stay cheap
+	if len(t.records) > t.retention+t.retention/4 {
+		t.records = append([]Record(nil), t.records[len(t.records)-t.retention:]...)
+	}
+
+	close(t.notify)
+	t.notify = make(chan struct{})
+	return offset
+}
+
+// End is the offset the next record will get.
+func (t *Topic) End() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
+}
+
+// read returns the records from offset on, or a channel that is closed once there are some.
+func (t *Topic) read(offset int64) ([]Record, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if offset >= t.next {
+		return nil, t.notify
+	}
+
+	first := t.next - int64(len(t.records))
+	if offset < first {
+		// Fell behind the retention, continue with the oldest record
+		offset = first
+	}
+	return append([]Record(nil), t.records[offset-first:]...), nil
+}
+
+// Subscribe delivers the records from offset on until ctx is done, offset < 0 starts at the end.
+func (t *Topic) Subscribe(ctx context.Context, offset int64) <-chan Record {
+	if offset < 0 {
+		offset = t.End()
+	}
+
+	out := make(chan Record, 256)
+	go func() {
+		defer close(out)
+
+		for {
+			records, wait := t.read(offset)
+			if wait != nil {
+				select {
+				case <-wait:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			for _, r := range records {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+				offset = r.Offset + 1
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,81 @@
+package mock
+
+import (
+	"fmt"
+	"time"
+	"wplug/pkg/message"
+)
+
+// Validate checks the fields the ingest service relies on.
+func Validate(msg message.Message) error {
+	if msg.DeviceInfo.DeviceID == "" {
+		return fmt.Errorf("deviceInfo.deviceId is missing")
+	}
+	if msg.DeviceInfo.Platform == "" {
+		return fmt.Errorf("deviceInfo.platform is missing")
+	}
+
+	start, err := parseTime("batchInfo.collectionStart", msg.BatchInfo.CollectionStart)
+	if err != nil {
+		return err
+	}
+	end, err := parseTime("batchInfo.collectionEnd", msg.BatchInfo.CollectionEnd)
+	if err != nil {
+		return err
+	}
+	if end.Before(start) {
+		return fmt.Errorf("batchInfo.collectionEnd is before collectionStart")
+	}
+
+	if msg.Timestamp != "" {
+		if _, err := parseTime("timestamp", msg.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	for i, c := range msg.Measurements.Cumulative {
+		field := fmt.Sprintf("measurements.cumulative[%d]", i)
+		if c.Type == "" || c.Unit == "" {
+			return fmt.Errorf("%s needs type and unit", field)
+		}
+		if c.Value < 0 {
+			return fmt.Errorf("%s.value is negative", field)
+		}
+		periodStart, err := parseTime(field+".periodStart", c.PeriodStart)
+		if err != nil {
+			return err
+		}
+		periodEnd, err := parseTime(field+".periodEnd", c.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		if periodEnd.Before(periodStart) {
+			return fmt.Errorf("%s.periodEnd is before periodStart", field)
+		}
+	}
+
+	for i, in := range msg.Measurements.Instantaneous {
+		field := fmt.Sprintf("measurements.instantaneous[%d]", i)
+		if in.Type == "" {
+			return fmt.Errorf("%s.type is missing", field)
+		}
+		if in.Timestamp != "" {
+			if _, err := parseTime(field+".timestamp", in.Timestamp); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseTime(field string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%s is missing", field)
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is not RFC 3339: %s", field, value)
+	}
+	return t, nil
+}
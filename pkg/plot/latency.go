@@ -2,6 +2,7 @@ package plot
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,7 +16,18 @@ import (
 // BoxPlot (combines both)
 // BoxPlot for Requests/sec
 
+// ErrColumnNotFound is returned for csv files written before a column was added.
+var ErrColumnNotFound = errors.New("column not found")
+
+// StageColumns are the pipeline stage latencies of message.Response, empty where a stage is unknown.
+var StageColumns = []string{"ingest-latency", "broker-to-kafka-latency", "consumer-lag"}
+
 func (p Plotter) GetLatencies() (map[time.Time][]float64, error) {
+	return p.GetColumnLatencies("latency")
+}
+
+// GetColumnLatencies groups a duration column per second, rows without a value are skipped.
+func (p Plotter) GetColumnLatencies(latencyHeader string) (map[time.Time][]float64, error) {
 	file, err := os.Open(p.InputPath)
 	if err != nil {
 		return nil, err
@@ -34,7 +46,6 @@ func (p Plotter) GetLatencies() (map[time.Time][]float64, error) {
 	//requestsPerSecond := make(map[time.Time]int64)
 
 	timestampHeader := "timestamp"
-	latencyHeader := "latency"
 
 	recordMap := make(map[string]int, len(headers))
 	for i, header := range headers {
@@ -43,6 +54,9 @@ func (p Plotter) GetLatencies() (map[time.Time][]float64, error) {
 		}
 		recordMap[header] = i
 	}
+	if _, exists := recordMap[latencyHeader]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrColumnNotFound, latencyHeader)
+	}
 
 	for {
 		record, err := reader.Read()
@@ -53,6 +67,10 @@ func (p Plotter) GetLatencies() (map[time.Time][]float64, error) {
 			return nil, err
 		}
 
+		if record[recordMap[latencyHeader]] == "" {
+			continue
+		}
+
 		rawTs := stripMonotonic(record[recordMap[timestampHeader]])
 		ts, err := parseTimestamp(rawTs)
 		if err != nil {
@@ -98,7 +116,11 @@ func (p Plotter) MedianLatency() (plotter.XYs, error) {
 }
 
 func (p Plotter) P99Latency() (plotter.XYs, error) {
-	latenciesPerSecond, err := p.GetLatencies()
+	return p.P99ColumnLatency("latency")
+}
+
+func (p Plotter) P99ColumnLatency(latencyHeader string) (plotter.XYs, error) {
+	latenciesPerSecond, err := p.GetColumnLatencies(latencyHeader)
 	if err != nil {
 		return nil, err
 	}
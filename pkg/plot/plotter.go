@@ -2,6 +2,7 @@ package plot
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -42,6 +43,24 @@ func (p Plotter) GeneratePlots() error {
 		return err
 	}
 
+	// Which hop is slow, only for the stages with values (e.g. not without a kafka consumer)
+	for _, column := range StageColumns {
+		stage, err := p.P99ColumnLatency(column)
+		if errors.Is(err, ErrColumnNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(stage) == 0 {
+			continue
+		}
+		err = PlotLineToSVG(stage, path.Join(p.OutputFolder, column+".svg"), "P99 "+column+"/ms", "Time (s)", column)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1,6 +1,8 @@
 package plot
 
 import (
+	"errors"
+	"os"
 	"path"
 	"testing"
 )
@@ -16,3 +18,31 @@ func TestPlotter_GeneratePlots(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestPlotter_StageColumns(t *testing.T) {
+	input := path.Join(t.TempDir(), "stages.csv")
+	csv := "timestamp,latency,ingest-latency\n" +
+		"2025-01-01 10:00:00.1 +0000 UTC,20ms,5ms\n" +
+		"2025-01-01 10:00:00.2 +0000 UTC,30ms,\n" +
+		"2025-01-01 10:00:01.1 +0000 UTC,25ms,7ms\n"
+	if err := os.WriteFile(input, []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := Plotter{InputPath: input}
+
+	latencies, err := p.GetColumnLatencies("ingest-latency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, vals := range latencies {
+		n += len(vals)
+	}
+	if len(latencies) != 2 || n != 2 {
+		t.Fatalf("expected 2 values in 2 seconds without the empty one, got %v", latencies)
+	}
+
+	if _, err := p.GetColumnLatencies("consumer-lag"); !errors.Is(err, ErrColumnNotFound) {
+		t.Fatalf("expected ErrColumnNotFound, got %v", err)
+	}
+}
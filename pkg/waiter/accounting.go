@@ -0,0 +1,141 @@
+package waiter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPhase names the whole run if the workload has no phases.
+const DefaultPhase = "run"
+
+// Phase of the run, it lasts from Start (relative to the start of the run) until the next phase starts.
+type Phase struct {
+	Name  string
+	Start time.Duration
+}
+
+// Account is the end-of-run accounting of one phase. A message and its duplicates count in the phase
+// it was registered in, right before it was sent; unknown confirmations in the phase they arrived in.
+type Account struct {
+	Phase      string
+	Sent       int64
+	Confirmed  int64
+	Lost       int64 // never confirmed: timeouts and messages still in flight when the run ended
+	Duplicates int64 // records of messages that were already confirmed
+	Unknown    int64 // confirmations nobody waited for, e.g. from outside the run or after a timeout
+}
+
+// InFlight are messages that were sent but neither confirmed nor lost yet.
+func (a Account) InFlight() int64 {
+	return a.Sent - a.Confirmed - a.Lost
+}
+
+func (a Account) String() string {
+	return fmt.Sprintf("%s: %d sent, %d confirmed, %d lost, %d duplicates, %d unknown", a.Phase, a.Sent, a.Confirmed, a.Lost, a.Duplicates, a.Unknown)
+}
+
+type account struct {
+	phase      string
+	sent       atomic.Int64
+	confirmed  atomic.Int64
+	lost       atomic.Int64
+	duplicates atomic.Int64
+	unknown    atomic.Int64
+}
+
+// schedule maps the time since start onto the phases
+type schedule struct {
+	start    time.Time
+	phases   []Phase
+	accounts []*account
+}
+
+func newSchedule(start time.Time, phases []Phase) *schedule {
+	if len(phases) == 0 {
+		phases = []Phase{{Name: DefaultPhase}}
+	}
+	accounts := make([]*account, len(phases))
+	for i := range accounts {
+		accounts[i] = &account{phase: phases[i].Name}
+	}
+	return &schedule{start: start, phases: phases, accounts: accounts}
+}
+
+// phase is the index of the last phase that started before t, before the first one t counts to it
+func (s *schedule) phase(t time.Time) int {
+	elapsed := t.Sub(s.start)
+	current := 0
+	for i, p := range s.phases {
+		if p.Start > elapsed {
+			break
+		}
+		current = i
+	}
+	return current
+}
+
+// SetPhases starts the accounting of a run that begins now. It is called where the workload starts,
+// before the consumers; the counts of an earlier run are dropped.
+func (rw *ResponseWaiter) SetPhases(phases ...Phase) {
+	rw.schedule.Store(newSchedule(time.Now(), phases))
+}
+
+// Accounting returns one Account per phase.
+func (rw *ResponseWaiter) Accounting() []Account {
+	s := rw.schedule.Load()
+
+	accounting := make([]Account, len(s.phases))
+	for i, a := range s.accounts {
+		accounting[i] = Account{
+			Phase:      s.phases[i].Name,
+			Sent:       a.sent.Load(),
+			Confirmed:  a.confirmed.Load(),
+			Lost:       a.lost.Load(),
+			Duplicates: a.duplicates.Load(),
+			Unknown:    a.unknown.Load(),
+		}
+	}
+	return accounting
+}
+
+// Total sums the accounting of all phases.
+func Total(accounting []Account) Account {
+	total := Account{Phase: "total"}
+	for _, a := range accounting {
+		total.Sent += a.Sent
+		total.Confirmed += a.Confirmed
+		total.Lost += a.Lost
+		total.Duplicates += a.Duplicates
+		total.Unknown += a.Unknown
+	}
+	return total
+}
+
+// WriteAccounting writes one csv row per phase and the total.
+func WriteAccounting(path string, accounting []Account) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating accounting file failed with err: %v", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"phase", "sent", "confirmed", "lost", "duplicates", "unknown", "in-flight"}); err != nil {
+		return err
+	}
+	for _, a := range append(accounting, Total(accounting)) {
+		record := []string{a.Phase}
+		for _, n := range []int64{a.Sent, a.Confirmed, a.Lost, a.Duplicates, a.Unknown, a.InFlight()} {
+			record = append(record, strconv.FormatInt(n, 10))
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
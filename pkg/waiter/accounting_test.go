@@ -0,0 +1,65 @@
+package waiter
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wplug/pkg/message"
+)
+
+func TestResponseWaiter_Accounting(t *testing.T) {
+	rw := NewResponseWaiter()
+	rw.Timeout = 20 * time.Millisecond
+	rw.SetPhases(Phase{Name: "ramp-up"}, Phase{Name: "steady", Start: 60 * time.Millisecond})
+
+	// ramp-up: one confirmed and delivered twice, one lost
+	ch := rw.Register("confirmed")
+	rw.DeliverKey("confirmed", message.Message{})
+	conf, err := rw.Wait(context.Background(), "confirmed", ch)
+	if err != nil || conf.Phase != "ramp-up" {
+		t.Fatalf("expected a confirmation in ramp-up, got %+v, %v", conf, err)
+	}
+	rw.DeliverKey("confirmed", message.Message{})
+
+	ch = rw.Register("lost")
+	if conf, err = rw.Wait(context.Background(), "lost", ch); err == nil || conf.Phase != "ramp-up" {
+		t.Fatalf("expected a timeout in ramp-up, got %+v, %v", conf, err)
+	}
+
+	// Registered in ramp-up, sent after the boundary: it and its duplicate stay in ramp-up
+	boundary := rw.Register("boundary")
+
+	// steady: the late confirmation and one from outside the run are unknown
+	time.Sleep(50 * time.Millisecond)
+	rw.DeliverKey("boundary", message.Message{})
+	if conf, err = rw.Wait(context.Background(), "boundary", boundary); err != nil || conf.Phase != "ramp-up" {
+		t.Fatalf("expected the boundary message in ramp-up, got %+v, %v", conf, err)
+	}
+	rw.DeliverKey("boundary", message.Message{})
+	rw.DeliverKey("lost", message.Message{})
+	rw.DeliverKey("outside", message.Message{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch = rw.Register("in-flight")
+	if conf, _ = rw.Wait(ctx, "in-flight", ch); conf.Phase != "steady" {
+		t.Fatalf("expected the cancelled message in steady, got %+v", conf)
+	}
+
+	accounting := rw.Accounting()
+	expected := []Account{
+		{Phase: "ramp-up", Sent: 3, Confirmed: 2, Lost: 1, Duplicates: 2},
+		{Phase: "steady", Sent: 1, Lost: 1, Unknown: 2},
+	}
+	if len(accounting) != len(expected) {
+		t.Fatalf("expected %d phases, got %v", len(expected), accounting)
+	}
+	for i := range expected {
+		if accounting[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected[i], accounting[i])
+		}
+	}
+	if total := Total(accounting); total.Sent != 4 || total.InFlight() != 0 {
+		t.Fatalf("unexpected total: %v", total)
+	}
+}
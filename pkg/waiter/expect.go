@@ -0,0 +1,40 @@
+package waiter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"wplug/pkg/message"
+)
+
+// ExpectFunc returns how many records the pipeline writes for msg, e.g. one per measurement.
+type ExpectFunc func(msg message.Message) int
+
+// ParseExpect reads the expect setting: a fixed count, or cumulative, instantaneous or
+// measurements (both) to expect one record per sample of the message.
+func ParseExpect(expect string) (ExpectFunc, error) {
+	switch strings.ToLower(expect) {
+	case "", "1":
+		return nil, nil
+	case "cumulative":
+		return func(msg message.Message) int {
+			return len(msg.Measurements.Cumulative)
+		}, nil
+	case "instantaneous":
+		return func(msg message.Message) int {
+			return len(msg.Measurements.Instantaneous)
+		}, nil
+	case "measurements":
+		return func(msg message.Message) int {
+			return len(msg.Measurements.Cumulative) + len(msg.Measurements.Instantaneous)
+		}, nil
+	}
+
+	n, err := strconv.Atoi(expect)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("expect must be a count of at least 1 or one of cumulative, instantaneous, measurements, is: %s", expect)
+	}
+	return func(message.Message) int {
+		return n
+	}, nil
+}
@@ -1,53 +1,499 @@
 package waiter
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
+	"time"
 	"wplug/pkg/message"
 )
 
-type ResponseWaiter struct {
+const (
+	// DefaultTimeout is how long a client waits for the confirmation of one message.
+	DefaultTimeout = 30 * time.Second
+	// DefaultShards spreads the in-flight messages so Register and Deliver rarely wait for each other.
+	DefaultShards = 64
+)
+
+// ErrConfirmationTimeout is reported when the message was sent but its confirmation didn't arrive in time.
+var ErrConfirmationTimeout = errors.New("confirmation timeout")
+
+type entry struct {
+	ch      chan message.Confirmation
+	waiting time.Time           // Wait started, zero while the client is still sending
+	stages  []message.StageTime // progress through the stages before the last one
+	// Records of the last stage, the message is confirmed when received reaches expected
+	expected int
+	received int
+	first    time.Time
+	last     time.Time
+	sent     *message.Message // fields verification only
+	account  *account         // of the phase the message was registered in
+	// complete entries stay for the Grace window, records on top of the expected ones are extra
+	complete bool
+	extra    int
+}
+
+// tombstone is a confirmed key, later records of it are duplicates
+type tombstone struct {
+	confirmed time.Time
+	account   *account
+	ch        chan message.Confirmation // the confirmation is on it, see abandon
+}
+
+// progress is the Confirmation so far
+func (e *entry) progress() message.Confirmation {
+	return message.Confirmation{
+		Stages:   e.stages,
+		Expected: e.expected,
+		Received: e.received,
+		First:    e.first,
+		Last:     e.last,
+	}
+}
+
+// shard holds the keys that hash to it, its mutex is only held for map operations
+type shard struct {
 	mu   sync.Mutex
-	wait map[string]chan message.Message
+	wait map[string]*entry
+	done map[string]tombstone
+}
+
+// ResponseWaiter matches the confirmations read by the consumers with the messages the clients wait for.
+// One is created per run and shared by all clients and consumers.
+type ResponseWaiter struct {
+	shards []*shard
+	seed   maphash.Seed
+	stages atomic.Pointer[[]string]
+	// Phases of the run for the accounting, see SetPhases
+	schedule atomic.Pointer[schedule]
+
+	// Read without locking, they are set by New and must not change once the first message is registered.
+	// Timeout bounds Wait, 0 waits until the ctx of the call ends
+	Timeout time.Duration
+	// Expect is the number of records the pipeline writes per message, nil means 1
+	Expect ExpectFunc
+	// Grace holds a confirmed message this long to count the records that arrive on top of the
+	// expected ones, 0 confirms right away and later records only count as duplicates
+	Grace time.Duration
+	// Verifier checks the confirmed message, nil disables it. It needs one record per message, Expect nil.
+	Verifier *Verifier
+
+	expired    atomic.Int64
+	orphaned   atomic.Int64
+	mismatched atomic.Int64
 }
 
-var respWaiters []*ResponseWaiter
+// Stats are the counters of a ResponseWaiter, logged at the end of a run.
+type Stats struct {
+	Pending    int
+	Expired    int64 // confirmation timeouts
+	Orphaned   int64 // entries nobody deregistered, removed by Sweep
+	Duplicates int64 // records of messages that were already confirmed
+	Unknown    int64 // confirmations nobody waited for
+	Mismatched int64 // confirmations that failed the verification
+}
 
-// GetResponseWaiter is used to enable that all async components use the same ResponseWaiter
-func GetResponseWaiter() *ResponseWaiter {
-	if len(respWaiters) == 0 {
-		log.Printf("len(respWaiters) == 0")
-		respWaiters = append(respWaiters, NewResponseWaiter())
+func (s Stats) String() string {
+	return fmt.Sprintf("%d pending, %d expired, %d orphaned, %d duplicates, %d unknown, %d mismatched", s.Pending, s.Expired, s.Orphaned, s.Duplicates, s.Unknown, s.Mismatched)
+}
+
+// Options configure a ResponseWaiter, see the fields of the same name.
+type Options struct {
+	Shards   int // 0 uses DefaultShards
+	Timeout  time.Duration
+	Expect   ExpectFunc
+	Grace    time.Duration
+	Verifier *Verifier
+}
+
+func New(opts Options) (*ResponseWaiter, error) {
+	if opts.Shards == 0 {
+		opts.Shards = DefaultShards
+	}
+	if opts.Shards < 0 {
+		return nil, fmt.Errorf("shards must be positive, is: %d", opts.Shards)
+	}
+	if opts.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative, is: %v", opts.Timeout)
+	}
+	if opts.Grace < 0 {
+		return nil, fmt.Errorf("grace must not be negative, is: %v", opts.Grace)
+	}
+	// The records of a fan-out are derived from the message, they can't be compared with it
+	if opts.Verifier != nil && opts.Expect != nil {
+		return nil, fmt.Errorf("verify needs one record per message, it can't be used together with expect")
 	}
 
-	return respWaiters[0]
+	rw := &ResponseWaiter{
+		shards:   make([]*shard, opts.Shards),
+		seed:     maphash.MakeSeed(),
+		Timeout:  opts.Timeout,
+		Expect:   opts.Expect,
+		Grace:    opts.Grace,
+		Verifier: opts.Verifier,
+	}
+	for i := range rw.shards {
+		rw.shards[i] = &shard{
+			wait: make(map[string]*entry),
+			done: make(map[string]tombstone),
+		}
+	}
+	rw.schedule.Store(newSchedule(time.Now(), nil))
+	return rw, nil
 }
 
+// NewResponseWaiter uses the default shards and timeout.
 func NewResponseWaiter() *ResponseWaiter {
-	return &ResponseWaiter{
-		wait: make(map[string]chan message.Message),
+	rw, _ := New(Options{Timeout: DefaultTimeout})
+	return rw
+}
+
+func (rw *ResponseWaiter) shard(key string) *shard {
+	return rw.shards[maphash.String(rw.seed, key)%uint64(len(rw.shards))]
+}
+
+// Register waits for one record of msgID.
+func (rw *ResponseWaiter) Register(msgID string) chan message.Confirmation {
+	return rw.register(msgID, 1, nil)
+}
+
+// RegisterMessage waits for the records Expect derives from msg, keyed on msg.CorrelationID().
+// It returns nil if msg has nothing to confirm, e.g. no samples, the client returns after the send.
+func (rw *ResponseWaiter) RegisterMessage(msg message.Message) chan message.Confirmation {
+	expected := rw.Expected(msg)
+	if expected == 0 {
+		return nil
 	}
+	var sent *message.Message
+	if rw.Verifier != nil && rw.Verifier.Mode == VerifyFields {
+		sent = &msg
+	}
+	return rw.register(msg.CorrelationID(), expected, sent)
+}
+
+// Expected is the number of records RegisterMessage waits for, 0 if the pipeline writes none.
+func (rw *ResponseWaiter) Expected(msg message.Message) int {
+	if rw.Expect == nil {
+		return 1
+	}
+	return rw.Expect(msg)
 }
 
-func (rw *ResponseWaiter) Register(msgID string) chan message.Message {
-	rw.mu.Lock()
-	defer rw.mu.Unlock()
+func (rw *ResponseWaiter) register(msgID string, expected int, sent *message.Message) chan message.Confirmation {
+	now := time.Now()
+	s := rw.schedule.Load()
+	ch := make(chan message.Confirmation, 1)
+	e := &entry{ch: ch, expected: expected, sent: sent, account: s.accounts[s.phase(now)]}
+	if stages := rw.stageNames(); len(stages) > 0 {
+		e.stages = make([]message.StageTime, len(stages))
+		for i, name := range stages {
+			e.stages[i].Name = name
+		}
+	}
 
-	ch := make(chan message.Message, 1)
-	rw.wait[msgID] = ch
+	sh := rw.shard(msgID)
+	sh.mu.Lock()
+	sh.wait[msgID] = e
+	sh.mu.Unlock()
 	return ch
 }
 
+// SetStages names the ordered stages of a pipeline, a message is confirmed when it reaches the last one.
+// It must be called before the first Register.
+func (rw *ResponseWaiter) SetStages(names ...string) {
+	rw.stages.Store(&names)
+}
+
+func (rw *ResponseWaiter) stageNames() []string {
+	if names := rw.stages.Load(); names != nil {
+		return *names
+	}
+	return nil
+}
+
+// Deregister removes the entry of msgID if it still belongs to ch. Clients defer it right after
+// Register, so the entry is gone on every exit path, also when the send failed.
+func (rw *ResponseWaiter) Deregister(msgID string, ch chan message.Confirmation) {
+	if ch == nil {
+		return
+	}
+	sh := rw.shard(msgID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if e, exists := sh.wait[msgID]; exists && e.ch == ch {
+		delete(sh.wait, msgID)
+	}
+}
+
+// Wait blocks until the confirmation arrives on ch, Timeout passes or ctx ends. On error the
+// Confirmation holds the progress of msgID so far, e.g. the stages and records it reached.
+// Clients call it once the message was sent, it counts as sent and then as confirmed or lost.
+func (rw *ResponseWaiter) Wait(ctx context.Context, msgID string, ch chan message.Confirmation) (message.Confirmation, error) {
+	account := rw.startWait(msgID, ch)
+	account.sent.Add(1)
+
+	var timeout <-chan time.Time
+	if rw.Timeout > 0 {
+		timer := time.NewTimer(rw.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var conf message.Confirmation
+	var err error
+	select {
+	case conf = <-ch:
+	case <-timeout:
+		conf, err = rw.abandon(msgID, ch, ErrConfirmationTimeout)
+	case <-ctx.Done():
+		conf, err = rw.abandon(msgID, ch, fmt.Errorf("context done"))
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrConfirmationTimeout) {
+			rw.expired.Add(1)
+		}
+		account.lost.Add(1)
+	} else {
+		account.confirmed.Add(1)
+		if rw.Grace > 0 {
+			conf = rw.hold(ctx, msgID, ch, conf)
+		}
+	}
+	conf.Phase = account.phase
+	return conf, err
+}
+
+// startWait marks the entry as waiting, Sweep ages it from now on. It returns the account of the
+// phase the message was registered in.
+func (rw *ResponseWaiter) startWait(msgID string, ch chan message.Confirmation) *account {
+	sh := rw.shard(msgID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if e, exists := sh.wait[msgID]; exists && e.ch == ch {
+		e.waiting = time.Now()
+		return e.account
+	}
+	// Confirmed before Wait started
+	if t, confirmed := sh.done[msgID]; confirmed {
+		return t.account
+	}
+	s := rw.schedule.Load()
+	return s.accounts[s.phase(time.Now())]
+}
+
+// hold keeps the complete entry for the Grace window, then replaces it with a tombstone and
+// reports the extra records it counted meanwhile
+func (rw *ResponseWaiter) hold(ctx context.Context, msgID string, ch chan message.Confirmation, conf message.Confirmation) message.Confirmation {
+	held := time.Now()
+	timer := time.NewTimer(rw.Grace)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	sh := rw.shard(msgID)
+	sh.mu.Lock()
+	if e, exists := sh.wait[msgID]; exists && e.ch == ch {
+		delete(sh.wait, msgID)
+		sh.done[msgID] = tombstone{confirmed: time.Now(), account: e.account, ch: ch}
+		conf.Extra = e.extra
+	}
+	sh.mu.Unlock()
+
+	conf.Grace = time.Since(held)
+	return conf
+}
+
+// abandon removes the entry and returns its progress with cause. The select of Wait picks at
+// random if the confirmation arrived together with the timeout, then it returns the confirmation.
+func (rw *ResponseWaiter) abandon(msgID string, ch chan message.Confirmation, cause error) (message.Confirmation, error) {
+	select {
+	case conf := <-ch:
+		return conf, nil
+	default:
+	}
+
+	sh := rw.shard(msgID)
+	sh.mu.Lock()
+	e, exists := sh.wait[msgID]
+	if exists && e.ch == ch && !e.complete {
+		delete(sh.wait, msgID)
+		sh.mu.Unlock()
+		return e.progress(), cause
+	}
+	t, confirmed := sh.done[msgID]
+	sh.mu.Unlock()
+
+	// DeliverStage completed the entry under the lock and sends right after it
+	if (exists && e.ch == ch) || (confirmed && t.ch == ch) {
+		return <-ch, nil
+	}
+	return message.Confirmation{}, cause
+}
+
+// Deliver matches the confirmation on msg.CorrelationID().
 func (rw *ResponseWaiter) Deliver(msg message.Message) {
-	rw.mu.Lock()
-	ch, exists := rw.wait[msg.DeviceInfo.DeviceID]
-	if exists {
-		delete(rw.wait, msg.DeviceInfo.DeviceID)
+	rw.DeliverKey(msg.CorrelationID(), msg)
+}
+
+// DeliverKey is used by consumers that extract the key themselves, e.g. from a header.
+func (rw *ResponseWaiter) DeliverKey(key string, msg message.Message) {
+	rw.DeliverConfirmation(key, message.Confirmation{Message: msg, ReceiveTime: time.Now()})
+}
+
+// DeliverConfirmation is used by consumers that know when the message was appended to their source.
+// With stages it counts as the last stage.
+func (rw *ResponseWaiter) DeliverConfirmation(key string, conf message.Confirmation) {
+	rw.DeliverStage(key, -1, conf)
+}
+
+// DeliverStage records that one record of the message reached stage. The message is confirmed when
+// the expected number of records reached the last stage (or -1).
+func (rw *ResponseWaiter) DeliverStage(key string, stage int, conf message.Confirmation) {
+	sh := rw.shard(key)
+	sh.mu.Lock()
+	e, exists := sh.wait[key]
+	if !exists {
+		// Only records of the last stage count, a message passes the others once per record
+		if stage < 0 || stage >= len(rw.stageNames())-1 {
+			if t, confirmed := sh.done[key]; confirmed {
+				t.account.duplicates.Add(1)
+			} else {
+				s := rw.schedule.Load()
+				s.accounts[s.phase(time.Now())].unknown.Add(1)
+			}
+		}
+		sh.mu.Unlock()
+		return
+	}
+	if e.complete {
+		// Held for the Grace window, like a duplicate only records of the last stage count
+		if stage < 0 || stage >= len(e.stages)-1 {
+			e.extra++
+			e.account.duplicates.Add(1)
+		}
+		sh.mu.Unlock()
+		return
+	}
+
+	if len(e.stages) > 0 {
+		if stage < 0 || stage >= len(e.stages) {
+			stage = len(e.stages) - 1
+		}
+		// The first arrival counts, like for the last stage
+		if e.stages[stage].ReceiveTime.IsZero() {
+			e.stages[stage].AppendTime = conf.AppendTime
+			e.stages[stage].ReceiveTime = conf.ReceiveTime
+		}
+		if stage < len(e.stages)-1 {
+			sh.mu.Unlock()
+			return
+		}
+	}
+
+	reached := conf.ReceiveTime
+	if !conf.AppendTime.IsZero() {
+		reached = conf.AppendTime
+	}
+	e.received++
+	if e.first.IsZero() {
+		e.first = reached
+	}
+	e.last = reached
+	if e.received < e.expected {
+		sh.mu.Unlock()
+		return
+	}
+
+	if rw.Grace > 0 {
+		// Wait replaces it with the tombstone once the Grace window passed
+		e.complete = true
+	} else {
+		delete(sh.wait, key)
+		sh.done[key] = tombstone{confirmed: time.Now(), account: e.account, ch: e.ch}
 	}
 
-	rw.mu.Unlock()
+	sh.mu.Unlock()
+
+	progress := e.progress()
+	conf.Stages = progress.Stages
+	conf.Expected = progress.Expected
+	conf.Received = progress.Received
+	conf.First = progress.First
+	conf.Last = progress.Last
+	if rw.Verifier != nil {
+		if conf.Err = rw.Verifier.Verify(e.sent, conf.Message); conf.Err != nil {
+			rw.mismatched.Add(1)
+		}
+	}
+	e.ch <- conf
+}
+
+// Sweep removes entries that have been waiting for longer than maxAge every interval until ctx ends.
+// It is a safety net for entries that were never deregistered, each one is counted as orphaned;
+// maxAge 0 keeps them. Entries age from the start of Wait, a send with retries can take longer than
+// the confirmation timeout and its client still deregisters the entry.
+// Confirmed keys are forgotten after maxAge (or interval), later records of them count as unknown instead of duplicates.
+func (rw *ResponseWaiter) Sweep(ctx context.Context, interval time.Duration, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if maxAge > 0 {
+				rw.sweep(now.Add(-maxAge), now.Add(-maxAge))
+			} else {
+				rw.sweep(time.Time{}, now.Add(-interval))
+			}
+		}
+	}
+}
+
+// sweep locks one shard at a time, Register and Deliver on the others go on
+func (rw *ResponseWaiter) sweep(waitingBefore time.Time, confirmedBefore time.Time) {
+	for _, sh := range rw.shards {
+		sh.mu.Lock()
+		for key, e := range sh.wait {
+			if !e.waiting.IsZero() && e.waiting.Before(waitingBefore) {
+				delete(sh.wait, key)
+				rw.orphaned.Add(1)
+			}
+		}
+		for key, t := range sh.done {
+			if t.confirmed.Before(confirmedBefore) {
+				delete(sh.done, key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+func (rw *ResponseWaiter) Stats() Stats {
+	var pending int
+	for _, sh := range rw.shards {
+		sh.mu.Lock()
+		pending += len(sh.wait)
+		sh.mu.Unlock()
+	}
 
-	if exists {
-		ch <- msg
+	total := Total(rw.Accounting())
+	return Stats{
+		Pending:    pending,
+		Expired:    rw.expired.Load(),
+		Orphaned:   rw.orphaned.Load(),
+		Duplicates: total.Duplicates,
+		Unknown:    total.Unknown,
+		Mismatched: rw.mismatched.Load(),
 	}
 }
@@ -0,0 +1,298 @@
+package waiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wplug/pkg/message"
+)
+
+func TestResponseWaiter_Timeout(t *testing.T) {
+	rw := NewResponseWaiter()
+	rw.Timeout = 20 * time.Millisecond
+
+	func() {
+		ch := rw.Register("late")
+		defer rw.Deregister("late", ch)
+
+		if _, err := rw.Wait(context.Background(), "late", ch); !errors.Is(err, ErrConfirmationTimeout) {
+			t.Fatalf("expected a confirmation timeout, got %v", err)
+		}
+	}()
+
+	// The late confirmation finds nothing and doesn't block
+	rw.DeliverKey("late", message.Message{})
+
+	if stats := rw.Stats(); stats.Pending != 0 || stats.Expired != 1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+// TestResponseWaiter_TimeoutRace has the confirmation and the timeout ready together when Wait
+// selects, or delivers right after the timeout. A message is either confirmed, or lost and its late
+// confirmation unknown, never lost with a confirmed tombstone.
+func TestResponseWaiter_TimeoutRace(t *testing.T) {
+	const n = 200
+	rw := NewResponseWaiter()
+	rw.Timeout = time.Nanosecond
+
+	var expired int64
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("race-%d", i)
+		ch := rw.Register(key)
+		if i%2 == 0 {
+			rw.DeliverKey(key, message.Message{})
+		} else {
+			time.AfterFunc(rw.Timeout, func() { rw.DeliverKey(key, message.Message{}) })
+		}
+
+		_, err := rw.Wait(context.Background(), key, ch)
+		switch {
+		case errors.Is(err, ErrConfirmationTimeout) && i%2 == 0:
+			t.Fatalf("%s was delivered before the timeout", key)
+		case errors.Is(err, ErrConfirmationTimeout):
+			expired++
+		case err != nil:
+			t.Fatal(err)
+		}
+		rw.Deregister(key, ch)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	total := Total(rw.Accounting())
+	if stats := rw.Stats(); stats.Expired != expired || total.Lost != expired || total.Unknown != expired || total.Confirmed != n-expired {
+		t.Fatalf("unexpected accounting %v with %d expired, stats: %v", total, expired, stats)
+	}
+}
+
+func TestResponseWaiter_DeregisterKeepsNewerEntry(t *testing.T) {
+	rw := NewResponseWaiter()
+
+	first := rw.Register("device-1")
+	second := rw.Register("device-1")
+	rw.Deregister("device-1", first)
+
+	rw.DeliverKey("device-1", message.Message{})
+	select {
+	case <-second:
+	default:
+		t.Fatal("deregistering the first entry removed the second")
+	}
+}
+
+func TestResponseWaiter_Sweep(t *testing.T) {
+	rw := NewResponseWaiter()
+	ch := rw.Register("leaked")
+	rw.startWait("leaked", ch)
+	// Not waiting yet, e.g. a slow send with retries
+	rw.Register("sending")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rw.Sweep(ctx, 5*time.Millisecond, time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for rw.Stats().Orphaned == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("entry was not swept: %v", rw.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if stats := rw.Stats(); stats.Pending != 1 || stats.Orphaned != 1 {
+		t.Fatalf("expected only the waiting entry swept: %v", stats)
+	}
+}
+
+func TestResponseWaiter_Stages(t *testing.T) {
+	rw := NewResponseWaiter()
+	rw.Timeout = 50 * time.Millisecond
+	rw.SetStages("raw", "validated", "aggregated")
+
+	complete := rw.Register("complete")
+	rw.DeliverStage("complete", 0, message.Confirmation{ReceiveTime: time.Now()})
+	select {
+	case <-complete:
+		t.Fatal("confirmed before the last stage")
+	default:
+	}
+	// validated is missed, the last stage still completes the message
+	rw.DeliverStage("complete", 2, message.Confirmation{ReceiveTime: time.Now()})
+
+	conf, err := rw.Wait(context.Background(), "complete", complete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Stages) != 3 || conf.Stages[0].Reached().IsZero() || !conf.Stages[1].Reached().IsZero() || conf.Stages[2].Name != "aggregated" {
+		t.Fatalf("unexpected stages: %+v", conf.Stages)
+	}
+
+	partial := rw.Register("partial")
+	rw.DeliverStage("partial", 0, message.Confirmation{ReceiveTime: time.Now()})
+
+	conf, err = rw.Wait(context.Background(), "partial", partial)
+	if !errors.Is(err, ErrConfirmationTimeout) {
+		t.Fatalf("expected a confirmation timeout, got %v", err)
+	}
+	if len(conf.Stages) != 3 || conf.Stages[0].Reached().IsZero() || !conf.Stages[2].Reached().IsZero() {
+		t.Fatalf("expected the progress up to raw, got %+v", conf.Stages)
+	}
+}
+
+func TestResponseWaiter_ExpectN(t *testing.T) {
+	rw := NewResponseWaiter()
+	rw.Timeout = 50 * time.Millisecond
+	expect, err := ParseExpect("cumulative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Expect = expect
+
+	msg := message.NewProvider(1, 1000).GetData()
+	n := len(msg.Measurements.Cumulative)
+	if n < 2 {
+		t.Fatalf("provider message has %d cumulative samples, the test needs 2", n)
+	}
+
+	ch := rw.RegisterMessage(msg)
+	for i := 0; i < n+1; i++ {
+		rw.Deliver(msg)
+		time.Sleep(time.Millisecond)
+	}
+
+	conf, err := rw.Wait(context.Background(), msg.CorrelationID(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Expected != n || conf.Received != n || !conf.Last.After(conf.First) {
+		t.Fatalf("unexpected fan-out: %+v", conf)
+	}
+	if stats := rw.Stats(); stats.Duplicates != 1 {
+		t.Fatalf("expected the record after the last one as duplicate: %v", stats)
+	}
+
+	// Half of the records arrive, the timeout reports the progress
+	if rw.Expect, err = ParseExpect("2"); err != nil {
+		t.Fatal(err)
+	}
+	split := message.NewProvider(1, 1000).GetData()
+	ch = rw.RegisterMessage(split)
+	rw.Deliver(split)
+
+	conf, err = rw.Wait(context.Background(), split.CorrelationID(), ch)
+	if !errors.Is(err, ErrConfirmationTimeout) || conf.Expected != 2 || conf.Received != 1 {
+		t.Fatalf("unexpected progress %+v, err %v", conf, err)
+	}
+
+	if _, err := ParseExpect("all"); err == nil {
+		t.Fatal("expected an error for an unknown expect value")
+	}
+}
+
+func TestResponseWaiter_Grace(t *testing.T) {
+	rw := NewResponseWaiter()
+	rw.Grace = 20 * time.Millisecond
+	rw.Expect, _ = ParseExpect("2")
+
+	msg := message.NewProvider(1, 1000).GetData()
+	ch := rw.RegisterMessage(msg)
+	for i := 0; i < 2; i++ {
+		rw.Deliver(msg)
+	}
+	// Arrives while the confirmation is held
+	time.AfterFunc(5*time.Millisecond, func() { rw.Deliver(msg) })
+
+	conf, err := rw.Wait(context.Background(), msg.CorrelationID(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Received != 2 || conf.Extra != 1 || conf.Grace < rw.Grace {
+		t.Fatalf("unexpected confirmation: %+v", conf)
+	}
+	res := message.Response{Latency: time.Second}.WithConfirmation(conf)
+	if res.Latency != time.Second-conf.Grace || res.Outcome() != "confirmed" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	// After the grace window the record is a duplicate of the tombstone
+	rw.Deliver(msg)
+	if stats := rw.Stats(); stats.Pending != 0 || stats.Duplicates != 2 || stats.Unknown != 0 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}
+
+func TestResponseWaiter_Concurrent(t *testing.T) {
+	rw, err := New(Options{Shards: 8, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("%d-%d", g, i)
+				ch := rw.Register(key)
+				go rw.DeliverKey(key, message.Message{})
+				if _, err := rw.Wait(context.Background(), key, ch); err != nil {
+					t.Error(err)
+				}
+				rw.Deregister(key, ch)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total := Total(rw.Accounting()); total.Sent != 8000 || total.Confirmed != 8000 {
+		t.Fatalf("unexpected accounting: %v", total)
+	}
+	if stats := rw.Stats(); stats.Pending != 0 || stats.Unknown != 0 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+	if _, err := New(Options{Shards: -1}); err == nil {
+		t.Fatal("expected an error for negative shards")
+	}
+	expect, _ := ParseExpect("cumulative")
+	if _, err := New(Options{Expect: expect, Verifier: &Verifier{Mode: VerifyHash}}); err == nil {
+		t.Fatal("expected an error for verify together with expect")
+	}
+}
+
+// BenchmarkResponseWaiter confirms messages on top of 50k in-flight ones that are never confirmed.
+func BenchmarkResponseWaiter(b *testing.B) {
+	const inFlight = 50_000
+
+	for _, shards := range []int{1, DefaultShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			rw, err := New(Options{Shards: shards, Timeout: time.Minute})
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i := 0; i < inFlight; i++ {
+				rw.Register("in-flight-" + strconv.Itoa(i))
+			}
+
+			var next atomic.Int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := strconv.FormatInt(next.Add(1), 10)
+					ch := rw.Register(key)
+					rw.DeliverKey(key, message.Message{})
+					if _, err := rw.Wait(context.Background(), key, ch); err != nil {
+						b.Error(err)
+					}
+					rw.Deregister(key, ch)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package waiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"wplug/pkg/message"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Config:
+// waiter:
+//	verify:
+//		mode: fields # fields (compare with the sent message), hash (embedded contentHash)
+//		ignore: ["deviceInfo.authorizationToken", "measurements.cumulative.*.unit"] # rewritten by the pipeline
+//		numeric-tolerance: 0.001 # e.g. unit conversions
+//---
+
+const (
+	VerifyFields = "fields"
+	VerifyHash   = "hash"
+	// maxDiffs limits the differences listed in one error
+	maxDiffs = 3
+)
+
+// ErrIntegrity is reported when the confirmed message differs from the sent one.
+var ErrIntegrity = errors.New("integrity mismatch")
+
+type VerifyConfig struct {
+	Mode             string   `yaml:"mode"`
+	Ignore           []string `yaml:"ignore"`
+	NumericTolerance float64  `yaml:"numeric-tolerance"`
+}
+
+// Verifier compares confirmed messages with what was sent. It needs one record per message,
+// New rejects it together with an ExpectFunc.
+type Verifier struct {
+	Mode      string
+	ignore    [][]string
+	tolerance float64
+	json      jsoniter.API
+}
+
+// NewVerifier returns nil if no mode is configured.
+func NewVerifier(config VerifyConfig) (*Verifier, error) {
+	mode := strings.ToLower(config.Mode)
+	if mode == "" {
+		return nil, nil
+	}
+	if mode != VerifyFields && mode != VerifyHash {
+		return nil, fmt.Errorf("verify mode must be one of fields, hash, is: %s", config.Mode)
+	}
+	if config.NumericTolerance < 0 {
+		return nil, fmt.Errorf("numeric-tolerance must not be negative, is: %v", config.NumericTolerance)
+	}
+
+	// The correlation fields are never part of the content
+	ignore := [][]string{{"messageId"}, {"contentHash"}}
+	for _, path := range config.Ignore {
+		ignore = append(ignore, strings.Split(path, "."))
+	}
+
+	return &Verifier{
+		Mode:      mode,
+		ignore:    ignore,
+		tolerance: config.NumericTolerance,
+		// Sorts map keys, the hash doesn't depend on the field order
+		json: jsoniter.ConfigCompatibleWithStandardLibrary,
+	}, nil
+}
+
+// Hash is the sha256 of the content of msg without the ignored fields.
+func (v *Verifier) Hash(msg message.Message) string {
+	b, err := v.json.Marshal(v.content(msg))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks received against sent (fields) or against its own embedded hash (hash).
+func (v *Verifier) Verify(sent *message.Message, received message.Message) error {
+	if v.Mode == VerifyHash {
+		if received.ContentHash == "" {
+			return fmt.Errorf("%w: contentHash missing", ErrIntegrity)
+		}
+		if hash := v.Hash(received); hash != received.ContentHash {
+			return fmt.Errorf("%w: contentHash %s, content hashes to %s", ErrIntegrity, received.ContentHash, hash)
+		}
+		return nil
+	}
+
+	if sent == nil {
+		return nil
+	}
+	var diffs []string
+	v.diff("", v.content(*sent), v.content(received), &diffs)
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %s", ErrIntegrity, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// content is msg as generic json without the ignored fields
+func (v *Verifier) content(msg message.Message) interface{} {
+	b, err := v.json.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	var content interface{}
+	if err := v.json.Unmarshal(b, &content); err != nil {
+		return nil
+	}
+
+	for _, path := range v.ignore {
+		remove(content, path)
+	}
+	return normalize(content)
+}
+
+// remove deletes path, * matches every element of an array or object
+func remove(node interface{}, path []string) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			if path[0] == "*" {
+				clear(n)
+			}
+			delete(n, path[0])
+			return
+		}
+		if path[0] == "*" {
+			for _, child := range n {
+				remove(child, path[1:])
+			}
+			return
+		}
+		remove(n[path[0]], path[1:])
+	case []interface{}:
+		if path[0] != "*" {
+			i, err := strconv.Atoi(path[0])
+			if err != nil || i < 0 || i >= len(n) {
+				return
+			}
+			if len(path) > 1 {
+				remove(n[i], path[1:])
+			}
+			return
+		}
+		if len(path) > 1 {
+			for _, child := range n {
+				remove(child, path[1:])
+			}
+		}
+	}
+}
+
+// normalize drops null and empty values, encoders differ in omitting them
+func normalize(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, child := range n {
+			if child = normalize(child); child == nil {
+				delete(n, key)
+			} else {
+				n[key] = child
+			}
+		}
+		if len(n) == 0 {
+			return nil
+		}
+		return n
+	case []interface{}:
+		if len(n) == 0 {
+			return nil
+		}
+		for i := range n {
+			n[i] = normalize(n[i])
+		}
+		return n
+	default:
+		return n
+	}
+}
+
+func (v *Verifier) diff(path string, sent interface{}, received interface{}, diffs *[]string) {
+	if len(*diffs) >= maxDiffs {
+		return
+	}
+
+	switch s := sent.(type) {
+	case map[string]interface{}:
+		r, ok := received.(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, fmt.Sprintf("%s: object != %v", pathName(path), received))
+			return
+		}
+		keys := make([]string, 0, len(s)+len(r))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		for key := range r {
+			if _, exists := s[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v.diff(joinPath(path, key), s[key], r[key], diffs)
+		}
+	case []interface{}:
+		r, ok := received.([]interface{})
+		if !ok || len(r) != len(s) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %d elements != %v", pathName(path), len(s), describe(received)))
+			return
+		}
+		for i := range s {
+			v.diff(joinPath(path, strconv.Itoa(i)), s[i], r[i], diffs)
+		}
+	case float64:
+		r, ok := received.(float64)
+		if !ok || math.Abs(s-r) > v.tolerance {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %v != %v", pathName(path), s, received))
+		}
+	default:
+		if sent != received {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %v != %v", pathName(path), sent, received))
+		}
+	}
+}
+
+func describe(node interface{}) string {
+	if n, ok := node.([]interface{}); ok {
+		return fmt.Sprintf("%d elements", len(n))
+	}
+	return fmt.Sprintf("%v", node)
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func pathName(path string) string {
+	if path == "" {
+		return "message"
+	}
+	return path
+}
@@ -0,0 +1,90 @@
+package waiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"wplug/pkg/message"
+)
+
+func TestVerifier_Fields(t *testing.T) {
+	v, err := NewVerifier(VerifyConfig{
+		Mode:             VerifyFields,
+		Ignore:           []string{"deviceInfo.authorizationToken", "measurements.cumulative.*.unit"},
+		NumericTolerance: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := message.NewProvider(1, 1000).GetData()
+	received := sent
+	received.MessageID = ""
+	received.DeviceInfo.AuthorizationToken = "rewritten"
+	received.Measurements.Cumulative = append([]message.Cumulative(nil), sent.Measurements.Cumulative...)
+	received.Measurements.Cumulative[0].Unit = "steps"
+	received.Measurements.Cumulative[0].Value++
+
+	if err := v.Verify(&sent, received); err != nil {
+		t.Fatalf("tolerated transforms reported: %v", err)
+	}
+
+	received.Measurements.Cumulative[0].Value += 10
+	received.SourceName = "Other iPhone"
+	err = v.Verify(&sent, received)
+	if !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected an integrity mismatch, got %v", err)
+	}
+}
+
+func TestVerifier_Hash(t *testing.T) {
+	v, err := NewVerifier(VerifyConfig{Mode: VerifyHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := message.NewProvider(1, 1000)
+	provider.ContentHash = v.Hash
+	sent := provider.GetData()
+	if sent.ContentHash == "" {
+		t.Fatal("provider did not embed the content hash")
+	}
+
+	if err := v.Verify(nil, sent); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := sent
+	corrupted.Measurements.Cumulative = append([]message.Cumulative(nil), sent.Measurements.Cumulative...)
+	corrupted.Measurements.Cumulative[0].Value++
+	if err := v.Verify(nil, corrupted); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected an integrity mismatch, got %v", err)
+	}
+}
+
+func TestResponseWaiter_Verify(t *testing.T) {
+	rw := NewResponseWaiter()
+	var err error
+	if rw.Verifier, err = NewVerifier(VerifyConfig{Mode: VerifyFields}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := message.NewProvider(1, 1000).GetData()
+	ch := rw.RegisterMessage(sent)
+
+	received := sent
+	received.Timestamp = "1970-01-01T00:00:00Z"
+	rw.Deliver(received)
+
+	conf, err := rw.Wait(context.Background(), sent.CorrelationID(), ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := message.Response{}.WithConfirmation(conf)
+	if !errors.Is(resp.Err, ErrIntegrity) {
+		t.Fatalf("expected the mismatch as response error, got %v", resp.Err)
+	}
+	if stats := rw.Stats(); stats.Mismatched != 1 {
+		t.Fatalf("unexpected stats: %v", stats)
+	}
+}